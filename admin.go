@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// adminMiddleware requires the configured admin token as a bearer token
+func (a *App) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		expected := a.Config.Server.AdminToken
+
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			a.auditAuthAs(r, "", "invalid admin token")
+			render.Error(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		a.auditAuthAs(r, auditActorAdmin, "")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setupAdminRoutes registers the operator endpoints under /admin. They are
+// only available when an admin token is configured.
+func (a *App) setupAdminRoutes() {
+	if a.Config.Server.AdminToken == "" {
+		return
+	}
+
+	admin := a.Group("/admin")
+	admin.Use(a.adminMiddleware)
+	admin.Handle("PUT", "/rate-limit", a.requireJSONMiddleware(http.HandlerFunc(a.rateLimitAdminHandler)).ServeHTTP)
+	admin.Handle("GET", "/routes", a.routesAdminHandler)
+	admin.Handle("GET", "/config", a.configAdminHandler)
+}
+
+// routesAdminHandler lists the registered routes
+func (a *App) routesAdminHandler(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, http.StatusOK, a.Routes())
+}
+
+// configAdminHandler responds with the live configuration, redacted so
+// that secrets are masked
+func (a *App) configAdminHandler(w http.ResponseWriter, r *http.Request) {
+	a.configMu.RLock()
+	cfg := a.Config.Redacted()
+	a.configMu.RUnlock()
+
+	render.JSON(w, http.StatusOK, cfg)
+}
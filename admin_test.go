@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestConfigAdminHandler(t *testing.T) {
+	cfg := config.Default()
+	cfg.JWT.Secret = "jwt-secret-value"
+	cfg.Database.Password = "db-password-value"
+	cfg.ExternalAPIs.APIKey = "api-key-value"
+	cfg.Server.AdminToken = "admin-token"
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Audit.SetOutput(io.Discard)
+
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{name: "Missing token", expectedCode: http.StatusUnauthorized},
+		{name: "Wrong token", token: "guess", expectedCode: http.StatusUnauthorized},
+		{name: "Admin token", token: "admin-token", expectedCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/config", nil)
+			require.NoError(t, err)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			for _, secret := range []string{"jwt-secret-value", "db-password-value", "api-key-value", "admin-token"} {
+				assert.NotContains(t, rr.Body.String(), secret)
+			}
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var got config.Config
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, cfg.Port, got.Port)
+			assert.Equal(t, "***", got.JWT.Secret)
+			assert.Equal(t, "***", got.Server.AdminToken)
+			assert.Equal(t, "", got.Redis.Password, "unset secrets stay empty")
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+func TestAuditAuth(t *testing.T) {
+	const secret = "webhook-secret"
+	const body = `{"event": "push"}`
+
+	tests := []struct {
+		name           string
+		signature      string
+		expectedResult string
+		expectedReason string
+	}{
+		{
+			name:           "Success",
+			signature:      sign(secret, body),
+			expectedResult: authSuccess,
+		},
+		{
+			name:           "Failure",
+			signature:      sign("wrong-secret", body),
+			expectedResult: authFailure,
+			expectedReason: "invalid signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp()
+			var audit bytes.Buffer
+			app.Audit.SetOutput(&audit)
+
+			handler := app.signatureMiddleware([]byte(secret))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req, err := http.NewRequest("POST", "/webhook", strings.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set(signatureHeader, tt.signature)
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var event logger.AuditEvent
+			require.NoError(t, json.Unmarshal(audit.Bytes(), &event))
+
+			assert.Equal(t, uint64(1), event.Seq)
+			assert.Equal(t, maskSubject(tt.signature), event.Actor)
+			assert.Equal(t, auditActionAuth, event.Action)
+			assert.Equal(t, "/webhook", event.Target)
+			assert.Equal(t, tt.expectedResult, event.Meta["result"])
+			assert.Equal(t, tt.expectedReason, event.Meta["reason"])
+			assert.NotContains(t, audit.String(), tt.signature)
+		})
+	}
+}
+
+func TestAuditRateLimitUpdate(t *testing.T) {
+	app := newRateLimitedApp(t, 10)
+	var audit bytes.Buffer
+	app.Audit.SetOutput(&audit)
+
+	req, err := http.NewRequest("PUT", "/admin/rate-limit", strings.NewReader(`{"requests_per_window": 5, "window": "30s"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer admin-token")
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	require.Len(t, lines, 2, "the authentication and the update are both audited")
+
+	var events [2]logger.AuditEvent
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &events[i]))
+	}
+	assert.Equal(t, auditActionAuth, events[0].Action)
+	assert.Equal(t, uint64(2), events[1].Seq)
+	assert.Equal(t, "admin", events[1].Actor)
+	assert.Equal(t, auditActionUpdate, events[1].Action)
+	assert.Equal(t, "rate_limit", events[1].Target)
+	assert.Equal(t, float64(5), events[1].Meta["requests_per_window"])
+	assert.Equal(t, "30s", events[1].Meta["window"])
+}
+
+func TestAuditAdminTokenNeverLogged(t *testing.T) {
+	const token = "Xq7-admin-token-Zk9"
+
+	cfg := config.Default()
+	cfg.Server.AdminToken = token
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	var audit bytes.Buffer
+	app.Audit.SetOutput(&audit)
+
+	for _, bearer := range []string{token, token[:len(token)-1] + "!"} {
+		req, err := http.NewRequest("GET", "/admin/routes", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		app.Router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var events [2]logger.AuditEvent
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &events[i]))
+	}
+	assert.Equal(t, auditActorAdmin, events[0].Actor)
+	assert.Equal(t, authSuccess, events[0].Meta["result"])
+	assert.Equal(t, "", events[1].Actor, "a near miss is not attributed")
+	assert.Equal(t, authFailure, events[1].Meta["result"])
+	for _, part := range []string{token[:2], token[len(token)-2:], maskSubject(token)} {
+		assert.NotContains(t, audit.String(), part)
+	}
+}
+
+func TestMaskSubject(t *testing.T) {
+	assert.Equal(t, "", maskSubject(""))
+	assert.Equal(t, "***", maskSubject("user-42"))
+	assert.Equal(t, "us***89", maskSubject("user-123456789"))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// bodyLimitMiddleware rejects request bodies larger than limit bytes.
+// Requests that declare an oversized Content-Length are rejected with 413
+// before any of the body is read. For clients sending
+// "Expect: 100-continue" this means net/http never sends the interim
+// 100 Continue response, so the body is not transmitted at all. Bodies of
+// unknown length are capped while the handler reads them.
+func (a *App) bodyLimitMiddleware(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				render.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
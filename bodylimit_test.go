@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func newBodyLimitApp(t *testing.T) *App {
+	t.Helper()
+	return newBodyLimitAppWithConfig(t, config.Default())
+}
+
+func newBodyLimitAppWithConfig(t *testing.T, cfg *config.Config) *App {
+	t.Helper()
+
+	cfg.FileUpload.MaxFileSize = "1KB"
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Router.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+	return app
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	app := newBodyLimitApp(t)
+
+	tests := []struct {
+		name           string
+		body           io.Reader
+		expectedStatus int
+	}{
+		{
+			name:           "Within limit",
+			body:           strings.NewReader(strings.Repeat("a", 1024)),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Declared length over limit",
+			body:           strings.NewReader(strings.Repeat("a", 1025)),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "Unknown length over limit",
+			body:           io.MultiReader(strings.NewReader(strings.Repeat("a", 2048))),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/upload", tt.body)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestBodyLimitRejectsBeforeContinue(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		assertRejectedBeforeContinue(t, newBodyLimitApp(t))
+	})
+
+	// Request body logging runs outside the body limit and must not read
+	// the body on its own
+	t.Run("With request body logging", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Logging.RequestBody = true
+		cfg.Logging.RequestBodyMaxBytes = 4096
+		assertRejectedBeforeContinue(t, newBodyLimitAppWithConfig(t, cfg))
+	})
+}
+
+// assertRejectedBeforeContinue checks that app answers an oversized upload
+// waiting for 100 Continue with 413 and no interim response
+func assertRejectedBeforeContinue(t *testing.T, app *App) {
+	t.Helper()
+
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	// Send only the headers, as a client waiting for 100 Continue would
+	fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", 1<<20)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// Cache outcomes recorded in the access log cache field
+const (
+	cacheHit    = "hit"
+	cacheMiss   = "miss"
+	cacheBypass = "bypass"
+)
+
+// cachedResponse is a stored successful response
+type cachedResponse struct {
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// maxCacheEntries bounds the number of responses a cache holds, since any
+// client can create entries by varying the query string
+const maxCacheEntries = 1000
+
+// responseCache stores GET responses keyed by URL and Accept header
+type responseCache struct {
+	mu         sync.RWMutex
+	entries    map[string]*cachedResponse
+	maxEntries int
+}
+
+// get returns the unexpired cached response for key, if any
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// set stores a response under key. When the cache is full, expired entries
+// are swept first and, if that frees nothing, the entry closest to expiry
+// is evicted.
+func (c *responseCache) set(key string, entry *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict(time.Now())
+	}
+	c.entries[key] = entry
+}
+
+// evict makes room for one entry. c.mu must be held.
+func (c *responseCache) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	if len(c.entries) >= c.maxEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// cacheKey identifies the variant of a response a request asks for
+func cacheKey(r *http.Request) string {
+	return r.URL.String() + "\x00" + r.Header.Get("Accept")
+}
+
+// cacheable reports whether a response with header may be stored under
+// cacheKey, which only distinguishes requests by URL and Accept
+func cacheable(header http.Header) bool {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, "Accept") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cacheRecorder captures the response while passing it through
+type cacheRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+
+	// streamed is set when the response was flushed or hijacked, which
+	// makes it unsuitable for caching
+	streamed bool
+}
+
+func (w *cacheRecorder) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *cacheRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer so streaming responses work
+// through the middleware. Flushed responses are not cached.
+func (w *cacheRecorder) Flush() {
+	w.streamed = true
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer so WebSocket upgrades work
+// through the middleware
+func (w *cacheRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack: %w", http.ErrNotSupported)
+	}
+	w.streamed = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *cacheRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cacheMiddleware serves repeated GET requests from memory for ttl, keyed
+// by URL and Accept header and holding at most maxCacheEntries responses.
+// Only 200 responses are stored, and not those that vary on other headers
+// or were streamed. Requests with "Cache-Control: no-cache", requests with
+// an Authorization header and non-GET requests bypass the cache. The
+// outcome is recorded in the access log as cache=hit|miss|bypass.
+func (a *App) cacheMiddleware(ttl time.Duration) mux.MiddlewareFunc {
+	cache := &responseCache{entries: make(map[string]*cachedResponse), maxEntries: maxCacheEntries}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" ||
+				strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				logger.AddAccessLogField(r.Context(), "cache", cacheBypass)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := cacheKey(r)
+			if entry, ok := cache.get(key); ok {
+				logger.AddAccessLogField(r.Context(), "cache", cacheHit)
+				for k, v := range entry.header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(http.StatusOK)
+				w.Write(entry.body)
+				return
+			}
+
+			logger.AddAccessLogField(r.Context(), "cache", cacheMiss)
+			w.Header().Set("X-Cache", "MISS")
+			recorder := &cacheRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.statusCode == http.StatusOK && !recorder.streamed && cacheable(w.Header()) {
+				header := w.Header().Clone()
+				header.Del("X-Cache")
+				cache.set(key, &cachedResponse{
+					header:  header,
+					body:    recorder.body.Bytes(),
+					expires: time.Now().Add(ttl),
+				})
+			}
+		})
+	}
+}
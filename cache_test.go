@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lastAccessLogFields returns the fields of the last access log entry
+func lastAccessLogFields(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var entry struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &entry))
+	return entry.Fields
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	app := NewApp()
+	var logs bytes.Buffer
+	app.Logger.SetOutput(&logs)
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"calls": %d}`, calls)
+	}
+	cached := app.Group("/cached")
+	cached.Use(app.cacheMiddleware(time.Minute))
+	cached.Handle("GET", "", handler)
+	cached.Handle("POST", "", handler)
+
+	tests := []struct {
+		name          string
+		method        string
+		cacheControl  string
+		expectedCache string
+		expectedBody  string
+	}{
+		{name: "Fresh response", method: "GET", expectedCache: cacheMiss, expectedBody: `{"calls": 1}`},
+		{name: "Cached response", method: "GET", expectedCache: cacheHit, expectedBody: `{"calls": 1}`},
+		{name: "No-cache request", method: "GET", cacheControl: "no-cache", expectedCache: cacheBypass, expectedBody: `{"calls": 2}`},
+		{name: "Non-GET request", method: "POST", expectedCache: cacheBypass, expectedBody: `{"calls": 3}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/cached", nil)
+			require.NoError(t, err)
+			if tt.cacheControl != "" {
+				req.Header.Set("Cache-Control", tt.cacheControl)
+			}
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expectedCache, lastAccessLogFields(t, &logs)["cache"])
+		})
+	}
+}
+
+func TestCacheMiddlewareVariants(t *testing.T) {
+	app := NewApp()
+	var logs bytes.Buffer
+	app.Logger.SetOutput(&logs)
+
+	calls := 0
+	cached := app.Group("/cached")
+	cached.Use(app.cacheMiddleware(time.Minute))
+	cached.Handle("GET", "", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, "%s %d", r.Header.Get("Accept"), calls)
+	})
+	cached.Handle("GET", "/vary", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "%d", calls)
+	})
+
+	get := func(path string, header map[string]string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr.Body.String()
+	}
+
+	assert.Equal(t, "application/json 1", get("/cached", map[string]string{"Accept": "application/json"}))
+	assert.Equal(t, "application/xml 2", get("/cached", map[string]string{"Accept": "application/xml"}), "Accept is part of the key")
+	assert.Equal(t, "application/json 1", get("/cached", map[string]string{"Accept": "application/json"}))
+
+	assert.Equal(t, "application/json 3", get("/cached", map[string]string{"Accept": "application/json", "Authorization": "Bearer a"}))
+	assert.Equal(t, cacheBypass, lastAccessLogFields(t, &logs)["cache"], "authorized responses are never shared")
+
+	assert.Equal(t, "4", get("/cached/vary", nil))
+	assert.Equal(t, "5", get("/cached/vary", nil), "responses varying on other headers are not stored")
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache := &responseCache{entries: make(map[string]*cachedResponse), maxEntries: 2}
+	now := time.Now()
+
+	cache.set("expired", &cachedResponse{expires: now.Add(-time.Second)})
+	cache.set("old", &cachedResponse{expires: now.Add(time.Minute)})
+	cache.set("new", &cachedResponse{expires: now.Add(2 * time.Minute)})
+	assert.Len(t, cache.entries, 2)
+	assert.NotContains(t, cache.entries, "expired", "expired entries are swept first")
+
+	cache.set("newest", &cachedResponse{expires: now.Add(3 * time.Minute)})
+	assert.Len(t, cache.entries, 2)
+	assert.NotContains(t, cache.entries, "old", "the entry closest to expiry is evicted")
+	assert.Contains(t, cache.entries, "newest")
+}
+
+func TestCacheRecorderForwardsWriterInterfaces(t *testing.T) {
+	rr := httptest.NewRecorder()
+	recorder := &cacheRecorder{ResponseWriter: rr, statusCode: http.StatusOK}
+
+	require.NoError(t, http.NewResponseController(recorder).Flush())
+	assert.True(t, rr.Flushed)
+	assert.True(t, recorder.streamed, "flushed responses are not cached")
+	assert.Same(t, http.ResponseWriter(rr), recorder.Unwrap())
+
+	_, _, err := recorder.Hijack()
+	assert.ErrorIs(t, err, http.ErrNotSupported)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clientErrorTracker counts client error responses per client in fixed
+// windows
+type clientErrorTracker struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	clients   map[string]*clientErrorWindow
+	lastSweep time.Time
+}
+
+// clientErrorWindow counts a client's errors in the current window
+type clientErrorWindow struct {
+	start    time.Time
+	count    int
+	reported bool
+}
+
+// newClientErrorTracker creates a tracker that reports clients with more
+// than threshold errors per window
+func newClientErrorTracker(threshold int, window time.Duration) *clientErrorTracker {
+	return &clientErrorTracker{
+		threshold: threshold,
+		window:    window,
+		clients:   make(map[string]*clientErrorWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+// record counts an error from key. It returns the count in the current
+// window and reports whether this error is the first to exceed the
+// threshold, so each client is reported at most once per window.
+func (t *clientErrorTracker) record(key string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+
+	client, ok := t.clients[key]
+	if !ok || now.Sub(client.start) >= t.window {
+		client = &clientErrorWindow{start: now}
+		t.clients[key] = client
+	}
+
+	client.count++
+	if client.count <= t.threshold || client.reported {
+		return client.count, false
+	}
+	client.reported = true
+	return client.count, true
+}
+
+// sweep drops expired client windows at most once per window. The caller
+// must hold t.mu.
+func (t *clientErrorTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.window {
+		return
+	}
+	for key, client := range t.clients {
+		if now.Sub(client.start) >= t.window {
+			delete(t.clients, key)
+		}
+	}
+	t.lastSweep = now
+}
+
+// clientErrorMiddleware logs a warning when a client receives more 4xx
+// responses within a window than the configured threshold
+func (a *App) clientErrorMiddleware(tracker *clientErrorTracker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.statusCode < 400 || recorder.statusCode >= 500 {
+				return
+			}
+
+			client := ClientIP(r)
+			count, exceeded := tracker.record(client)
+			if !exceeded {
+				return
+			}
+
+			a.Logger.WithFields(map[string]interface{}{
+				"client_ip":   client,
+				"errors":      count,
+				"window":      tracker.window.String(),
+				"status_code": recorder.statusCode,
+				"path":        r.URL.Path,
+			}).Warn("Client exceeded the client error threshold")
+		})
+	}
+}
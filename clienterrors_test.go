@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestClientErrorThreshold(t *testing.T) {
+	const warning = "Client exceeded the client error threshold"
+
+	cfg := config.Default()
+	cfg.RateLimit.ClientErrorThreshold = 3
+	cfg.RateLimit.ClientErrorWindow = time.Minute
+	app := NewAppWithConfig(cfg)
+	var buf bytes.Buffer
+	app.Logger.SetOutput(&buf)
+	app.Handle("GET", "/bad", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	send := func(path, remoteAddr string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		app.Router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Successful requests are not counted
+	for i := 0; i < 5; i++ {
+		send("/health", "192.0.2.1:1234")
+	}
+
+	for i := 0; i < 3; i++ {
+		send("/bad", "192.0.2.1:1234")
+	}
+	assert.NotContains(t, buf.String(), warning, "reaching the threshold is allowed")
+
+	send("/bad", "192.0.2.1:1234")
+	assert.Equal(t, 1, strings.Count(buf.String(), warning))
+	assert.Contains(t, buf.String(), `"client_ip":"192.0.2.1"`)
+
+	// Further errors in the same window are collapsed into one warning
+	for i := 0; i < 5; i++ {
+		send("/bad", "192.0.2.1:1234")
+	}
+	assert.Equal(t, 1, strings.Count(buf.String(), warning))
+
+	// Other clients are counted separately
+	send("/bad", "192.0.2.2:1234")
+	assert.Equal(t, 1, strings.Count(buf.String(), warning))
+}
+
+func TestClientErrorTrackerWindow(t *testing.T) {
+	tracker := newClientErrorTracker(1, 50*time.Millisecond)
+
+	_, exceeded := tracker.record("a")
+	assert.False(t, exceeded)
+	_, exceeded = tracker.record("a")
+	assert.True(t, exceeded)
+
+	time.Sleep(60 * time.Millisecond)
+
+	count, exceeded := tracker.record("a")
+	assert.Equal(t, 1, count, "a new window starts from zero")
+	assert.False(t, exceeded)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPKey is the context key of the client IP resolved by
+// clientIPMiddleware
+type clientIPKey struct{}
+
+// ClientIP returns the IP address of the client that sent r. When the
+// request came through one of the configured trusted proxies this is the
+// address reported in X-Forwarded-For or X-Real-IP; otherwise it is the host
+// of r.RemoteAddr, so headers sent by anyone else cannot spoof it.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// clientIPMiddleware resolves the client IP once per request so that
+// ClientIP, the access log and the rate limiter agree on it
+func (a *App) clientIPMiddleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+		})
+	}
+}
+
+// resolveClientIP returns the client IP of r, believing the forwarding
+// headers only when the direct peer is in trusted. X-Forwarded-For is read
+// from the right: every proxy appends the address it received the request
+// from, so the first entry not in trusted is the client and anything left of
+// it may have been made up by the client. X-Real-IP is used when there is no
+// X-Forwarded-For.
+func resolveClientIP(r *http.Request, trusted []netip.Prefix) string {
+	host := remoteHost(r)
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !containsAddr(trusted, peer.Unmap()) {
+		return host
+	}
+
+	hops := forwardedFor(r.Header.Values("X-Forwarded-For"))
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			// A malformed entry ends the chain we can trust; the proxy
+			// that appended the entry to its right is the best we know
+			break
+		}
+		if i == 0 || !containsAddr(trusted, addr) {
+			return addr.String()
+		}
+		host = addr.String()
+	}
+	if len(hops) > 0 {
+		return host
+	}
+
+	if addr, ok := parseHop(r.Header.Get("X-Real-IP")); ok {
+		return addr.String()
+	}
+	return host
+}
+
+// forwardedFor splits X-Forwarded-For header values into their entries, in
+// order. Several headers are treated as one comma-separated list.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop parses a forwarded address, which some proxies send with a port
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// containsAddr reports whether addr is in one of prefixes
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestClientIP(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.7"}
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+
+	var got string
+	app.Handle("GET", "/ip", func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{
+			name:       "untrusted peer without headers",
+			remoteAddr: "203.0.113.5:4000",
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "untrusted peer cannot spoof X-Forwarded-For",
+			remoteAddr: "203.0.113.5:4000",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "untrusted peer cannot spoof X-Real-IP",
+			remoteAddr: "203.0.113.5:4000",
+			headers:    map[string][]string{"X-Real-IP": {"198.51.100.1"}},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "trusted peer",
+			remoteAddr: "10.1.2.3:4000",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "trusted single address",
+			remoteAddr: "192.0.2.7:4000",
+			headers:    map[string][]string{"X-Real-IP": {"198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "client-supplied entries left of the client are ignored",
+			remoteAddr: "10.1.2.3:4000",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.9.9.9"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "several headers form one list",
+			remoteAddr: "10.1.2.3:4000",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.1.1.1", "198.51.100.1:5555"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "chain of trusted proxies only",
+			remoteAddr: "10.1.2.3:4000",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.8.0.1, 10.9.9.9"}},
+			want:       "10.8.0.1",
+		},
+		{
+			name:       "malformed entry stops at the nearest trusted hop",
+			remoteAddr: "10.1.2.3:4000",
+			headers:    map[string][]string{"X-Forwarded-For": {"not-an-ip, 10.9.9.9"}},
+			want:       "10.9.9.9",
+		},
+		{
+			name:       "X-Forwarded-For takes precedence over X-Real-IP",
+			remoteAddr: "10.1.2.3:4000",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"198.51.100.1"},
+				"X-Real-IP":       {"198.51.100.2"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:       "trusted peer without headers",
+			remoteAddr: "10.1.2.3:4000",
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "IPv6 client",
+			remoteAddr: "10.1.2.3:4000",
+			headers:    map[string][]string{"X-Forwarded-For": {"2001:db8::1"}},
+			want:       "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req := httptest.NewRequest("GET", "/ip", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				for _, v := range values {
+					req.Header.Add(name, v)
+				}
+			}
+
+			app.Router.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:4000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	assert.Equal(t, "10.1.2.3", ClientIP(req), "headers are ignored when no proxy is trusted")
+}
+
+func TestRateLimitUsesClientIP(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit = config.RateLimitConfig{Enabled: true, RequestsPerWindow: 1, WindowDuration: time.Minute}
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8"}
+	app := NewAppWithConfig(cfg)
+	var buf bytes.Buffer
+	app.Logger.SetOutput(&buf)
+
+	send := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Clients behind the same trusted proxy are limited separately
+	assert.Equal(t, http.StatusOK, send("10.1.2.3:4000", "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, send("10.1.2.3:4000", "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.1.2.3:4000", "198.51.100.1"))
+
+	// An untrusted client cannot escape the limit by changing the header
+	assert.Equal(t, http.StatusOK, send("203.0.113.5:4000", "198.51.100.3"))
+	assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.5:4000", "198.51.100.4"))
+
+	assert.Contains(t, buf.String(), `"client_ip":"198.51.100.1"`)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLastModified(t *testing.T) {
+	modtime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		ifModifiedSince string
+		expectedStatus  int
+	}{
+		{
+			name:           "No conditional header",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:            "Client copy is newer",
+			ifModifiedSince: modtime.Add(time.Hour).Format(http.TimeFormat),
+			expectedStatus:  http.StatusNotModified,
+		},
+		{
+			name:            "Client copy is current",
+			ifModifiedSince: modtime.Format(http.TimeFormat),
+			expectedStatus:  http.StatusNotModified,
+		},
+		{
+			name:            "Client copy is stale",
+			ifModifiedSince: modtime.Add(-time.Hour).Format(http.TimeFormat),
+			expectedStatus:  http.StatusOK,
+		},
+		{
+			name:            "Malformed date",
+			ifModifiedSince: "yesterday",
+			expectedStatus:  http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			require.NoError(t, err)
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+
+			rr := httptest.NewRecorder()
+			if !checkLastModified(rr, req, modtime) {
+				rr.WriteHeader(http.StatusOK)
+			}
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, modtime.Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+		})
+	}
+}
+
+func TestVersionHandlerIsNeverNotModified(t *testing.T) {
+	app := NewApp()
+	req, err := http.NewRequest("GET", "/version", nil)
+	require.NoError(t, err)
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	// The response includes live memory stats
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Last-Modified"))
+	assert.Contains(t, rr.Body.String(), "alloc_bytes")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// requireJSONMiddleware rejects requests whose body is not JSON with 415
+// Unsupported Media Type. The Content-Type must be application/json, with
+// optional parameters such as charset. It is meant for mutating routes:
+// GET, HEAD, DELETE and OPTIONS requests without a body pass through.
+func (a *App) requireJSONMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasBody(r) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			render.Error(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasBody reports whether r has, or may have, a request body
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
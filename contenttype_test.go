@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireJSONMiddleware(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	handler := app.requireJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name         string
+		method       string
+		contentType  string
+		body         string
+		expectedCode int
+	}{
+		{name: "JSON", method: "POST", contentType: "application/json", body: `{}`, expectedCode: http.StatusNoContent},
+		{name: "JSON with charset", method: "PUT", contentType: "application/json; charset=utf-8", body: `{}`, expectedCode: http.StatusNoContent},
+		{name: "Case insensitive", method: "PATCH", contentType: "Application/JSON", body: `{}`, expectedCode: http.StatusNoContent},
+		{name: "Wrong type", method: "POST", contentType: "text/plain", body: `{}`, expectedCode: http.StatusUnsupportedMediaType},
+		{name: "Form", method: "PUT", contentType: "application/x-www-form-urlencoded", body: "a=1", expectedCode: http.StatusUnsupportedMediaType},
+		{name: "Missing type", method: "POST", body: `{}`, expectedCode: http.StatusUnsupportedMediaType},
+		{name: "Missing type without body", method: "POST", expectedCode: http.StatusUnsupportedMediaType},
+		{name: "Malformed type", method: "POST", contentType: "application/json; charset", body: `{}`, expectedCode: http.StatusUnsupportedMediaType},
+		{name: "GET without body", method: "GET", expectedCode: http.StatusNoContent},
+		{name: "DELETE without body", method: "DELETE", expectedCode: http.StatusNoContent},
+		{name: "OPTIONS without body", method: "OPTIONS", expectedCode: http.StatusNoContent},
+		{name: "DELETE with text body", method: "DELETE", contentType: "text/plain", body: "x", expectedCode: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, "/items", body)
+			require.NoError(t, err)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expectedCode == http.StatusUnsupportedMediaType {
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				assert.JSONEq(t, `{"error": "Content-Type must be application/json"}`, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRateLimitAdminRequiresJSON(t *testing.T) {
+	app := newRateLimitedApp(t, 3)
+
+	req, err := http.NewRequest("PUT", "/admin/rate-limit", strings.NewReader(`{"requests_per_window": 1, "window": "1m"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	req.Header.Set("Content-Type", "text/plain")
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.Equal(t, 3, countAllowed(t, app, 5), "the limit is unchanged")
+}
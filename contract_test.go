@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Regenerate the golden files with: go test -run TestResponseContracts -update
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// volatileValue replaces values that differ between runs
+const volatileValue = "<volatile>"
+
+// volatileFields are response fields whose values change between runs or
+// builds. Their values are normalized so only the shape is compared.
+var volatileFields = map[string]bool{
+	"timestamp":         true,
+	"uptime":            true,
+	"commit":            true,
+	"build_time":        true,
+	"go_version":        true,
+	"alloc_bytes":       true,
+	"total_alloc_bytes": true,
+	"sys_bytes":         true,
+	"num_gc":            true,
+}
+
+// CaptureResponses sends a GET request for each route through the app's
+// router and returns the JSON responses by route, with volatile fields
+// normalized and keys sorted so that the output is stable across runs.
+// Bodies that are not JSON are returned as JSON strings.
+func CaptureResponses(app *App, routes []string) map[string]json.RawMessage {
+	responses := make(map[string]json.RawMessage, len(routes))
+	for _, route := range routes {
+		req := httptest.NewRequest(http.MethodGet, route, nil)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+
+		responses[route] = normalizeJSON(rr.Body.Bytes())
+	}
+	return responses
+}
+
+// normalizeJSON masks volatile fields in body and re-encodes it indented
+func normalizeJSON(body []byte) json.RawMessage {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		value = string(body)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(maskVolatile(value))
+	return bytes.TrimSpace(buf.Bytes())
+}
+
+// maskVolatile replaces the values of volatile fields, recursing into
+// nested objects and arrays
+func maskVolatile(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if volatileFields[key] {
+				v[key] = volatileValue
+			} else {
+				v[key] = maskVolatile(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = maskVolatile(item)
+		}
+	}
+	return value
+}
+
+// assertGolden compares got with testdata/golden/<name>.json, or rewrites
+// that file when the -update flag is set
+func assertGolden(t *testing.T, name string, got json.RawMessage) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	got = append(got, '\n')
+
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "missing golden file, run the test with -update to create it")
+	assert.Equal(t, string(want), string(got), "response for %s changed, run the test with -update if this is intended", name)
+}
+
+// goldenName turns a route into a golden file name
+func goldenName(route string) string {
+	name := strings.Trim(strings.ReplaceAll(route, "/", "_"), "_")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
+
+func TestResponseContracts(t *testing.T) {
+	routes := []string{"/", "/health", "/version", "/api/v1/status"}
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+	responses := CaptureResponses(app, routes)
+
+	for _, route := range routes {
+		t.Run(route, func(t *testing.T) {
+			assertGolden(t, goldenName(route), responses[route])
+		})
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	body := []byte(`{"status":"ok","timestamp":"2024-01-15T10:30:00Z","memory":{"num_gc":3},"items":[{"uptime":"5s"}]}`)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(normalizeJSON(body), &got))
+
+	assert.Equal(t, "ok", got["status"])
+	assert.Equal(t, volatileValue, got["timestamp"])
+	assert.Equal(t, map[string]interface{}{"num_gc": volatileValue}, got["memory"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"uptime": volatileValue}}, got["items"])
+
+	assert.JSONEq(t, `"not json"`, string(normalizeJSON([]byte("not json"))))
+}
@@ -0,0 +1,23 @@
+package main
+
+import "net/http"
+
+// StartH2C initializes and starts the HTTP server accepting HTTP/2 over
+// cleartext (h2c) as well as HTTP/1.1, for proxies such as Envoy that speak
+// HTTP/2 to the backend without TLS. Clients must use HTTP/2 with prior
+// knowledge; the HTTP/1.1 Upgrade: h2c mechanism is not supported.
+// Shutdown stops the server exactly as it does for Start.
+func (a *App) StartH2C(port string) error {
+	a.Server = a.newServer(port)
+	a.Server.Protocols = new(http.Protocols)
+	a.Server.Protocols.SetHTTP1(true)
+	a.Server.Protocols.SetUnencryptedHTTP2(true)
+
+	ln, err := a.listen()
+	if err != nil {
+		return err
+	}
+
+	a.logStartup(listenPort(ln, port), false)
+	return a.Server.Serve(ln)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppStartH2C(t *testing.T) {
+	app := NewApp()
+	out := &syncBuffer{}
+	app.Logger.SetOutput(out)
+
+	var proto string
+	app.Handle("GET", "/proto", func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- app.StartH2C("0")
+	}()
+	addr := waitForAddr(t, app)
+
+	// An HTTP/2 client with prior knowledge, as Envoy uses for h2c
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	resp, err := client.Get("http://" + addr + "/proto")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "HTTP/2.0", proto)
+
+	// HTTP/1.1 keeps working on the same port
+	resp, err = http.Get("http://" + addr + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, resp.ProtoMajor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, app.Shutdown(ctx))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+
+	// The access log captured the status of the HTTP/2 request
+	var found bool
+	for _, line := range bytes.Split([]byte(out.String()), []byte("\n")) {
+		var entry struct {
+			Message string                 `json:"message"`
+			Fields  map[string]interface{} `json:"fields"`
+		}
+		if json.Unmarshal(line, &entry) != nil || entry.Message != "HTTP request" {
+			continue
+		}
+		if entry.Fields["url"] == "/proto" {
+			found = true
+			assert.Equal(t, float64(http.StatusAccepted), entry.Fields["status_code"])
+		}
+	}
+	assert.True(t, found, "the HTTP/2 request is in the access log")
+}
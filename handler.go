@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// HandlerFunc is an HTTP handler that reports failure by returning an
+// error instead of writing the error response itself. Use App.wrap to
+// register it.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// statusCoder is implemented by errors that map to an HTTP status code
+type statusCoder interface {
+	StatusCode() int
+}
+
+// httpError is an error with an HTTP status code and a message that is
+// safe to show to clients
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string   { return e.message }
+func (e *httpError) StatusCode() int { return e.status }
+
+// errHTTP returns an error that wrap turns into a response with the given
+// status and message
+func errHTTP(status int, message string) error {
+	return &httpError{status: status, message: message}
+}
+
+// errUnauthorized is returned by handlers that need an authenticated caller
+// when there is none
+var errUnauthorized = errHTTP(http.StatusUnauthorized, "unauthorized")
+
+// wrap adapts h to an http.HandlerFunc. When h returns an error, the
+// status code and message are taken from the first error in its chain with
+// a StatusCode method. Other errors become a 500 with a generic message so
+// internal details do not leak. The response body is {"error": message}
+// and the full error is logged with the request's IDs.
+func (a *App) wrap(h HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := h(w, r)
+		if err == nil {
+			return
+		}
+
+		status := http.StatusInternalServerError
+		message := "internal server error"
+		var coder statusCoder
+		if errors.As(err, &coder) {
+			status = coder.StatusCode()
+			// Context added by wrapping is for the log, not the client
+			message = coder.(error).Error()
+		}
+
+		log := a.Logger.WithContext(r.Context()).WithFields(map[string]interface{}{
+			"error":       err.Error(),
+			"status_code": status,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+		})
+		if status >= http.StatusInternalServerError {
+			log.Error("Handler failed")
+		} else {
+			log.Warn("Handler rejected request")
+		}
+
+		render.Error(w, status, message)
+	}
+}
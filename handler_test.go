@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// teapotError implements StatusCode without using errHTTP
+type teapotError struct{}
+
+func (teapotError) Error() string   { return "short and stout" }
+func (teapotError) StatusCode() int { return http.StatusTeapot }
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "Sentinel", err: errUnauthorized, expectedCode: http.StatusUnauthorized, expectedBody: `{"error": "unauthorized"}`},
+		{name: "Wrapped", err: fmt.Errorf("loading user 42: %w", errUnauthorized), expectedCode: http.StatusUnauthorized, expectedBody: `{"error": "unauthorized"}`},
+		{name: "Custom message", err: errHTTP(http.StatusConflict, "name <beto> is taken"), expectedCode: http.StatusConflict, expectedBody: `{"error": "name <beto> is taken"}`},
+		{name: "StatusCode method", err: teapotError{}, expectedCode: http.StatusTeapot, expectedBody: `{"error": "short and stout"}`},
+		{name: "Plain error", err: errors.New("dial tcp 10.0.0.5:5432: connection refused"), expectedCode: http.StatusInternalServerError, expectedBody: `{"error": "internal server error"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp()
+			var buf bytes.Buffer
+			app.Logger.SetOutput(&buf)
+
+			handler := app.wrap(func(w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+
+			req, err := http.NewRequest("GET", "/items", nil)
+			require.NoError(t, err)
+			req = req.WithContext(context.WithValue(req.Context(), logger.RequestIDKey, "req-123"))
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+
+			var entry struct {
+				Fields map[string]interface{} `json:"fields"`
+			}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, "req-123", entry.Fields["request_id"])
+			assert.Equal(t, tt.err.Error(), entry.Fields["error"], "the full error is logged")
+		})
+	}
+}
+
+func TestWrapSuccess(t *testing.T) {
+	app := NewApp()
+	var buf bytes.Buffer
+	app.Logger.SetOutput(&buf)
+
+	handler := app.wrap(func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/items", nil))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/auth"
+	"github.com/darkcloud/beto/pkg/logger"
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+type contextKey string
+
+// claimsKey stores the verified JWT claims in the request context
+const claimsKey contextKey = "jwt_claims"
+
+// claimsFromContext returns the JWT claims stored by jwtAuthMiddleware
+func claimsFromContext(ctx context.Context) (auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(auth.Claims)
+	return claims, ok
+}
+
+// jwtAuthMiddleware requires a bearer token signed with JWT.Secret. On
+// success the claims are stored in the request context and the subject is
+// stored under logger.UserIDKey so logger.WithContext picks it up.
+func (a *App) jwtAuthMiddleware(next http.Handler) http.Handler {
+	secret := []byte(a.Config.JWT.Secret)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			a.auditAuth(r, "", "missing bearer token")
+			writeAuthError(w, "missing bearer token")
+			return
+		}
+
+		claims, err := auth.Parse(token, secret, time.Now())
+		if err != nil {
+			a.auditAuth(r, "", err.Error())
+			message := "invalid token"
+			if errors.Is(err, auth.ErrExpiredToken) {
+				message = "token expired"
+			}
+			writeAuthError(w, message)
+			return
+		}
+
+		subject := claims.Subject()
+		a.auditAuth(r, subject, "")
+
+		ctx := context.WithValue(r.Context(), claimsKey, claims)
+		ctx = context.WithValue(ctx, logger.UserIDKey, subject)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// writeAuthError responds with 401 and a JSON error body
+func writeAuthError(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	render.Error(w, http.StatusUnauthorized, message)
+}
+
+// Protected returns a RouteGroup for routes under prefix that require a
+// valid JWT. Routes registered outside a protected group stay public.
+func (a *App) Protected(prefix string) *RouteGroup {
+	group := a.Group(prefix)
+	group.Use(a.jwtAuthMiddleware)
+	return group
+}
+
+// meHandler returns the identity of the authenticated caller
+func (a *App) meHandler(w http.ResponseWriter, r *http.Request) error {
+	claims, ok := claimsFromContext(r.Context())
+	if !ok {
+		return errUnauthorized
+	}
+
+	render.JSON(w, http.StatusOK, map[string]string{"user_id": claims.Subject()})
+	return nil
+}
+
+// RequireScopes returns middleware that responds 403 unless the request's
+// JWT grants every one of scopes through its scope or scopes claim. It must
+// run after jwtAuthMiddleware, for example on a group from Protected.
+func (a *App) RequireScopes(scopes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := claimsFromContext(r.Context())
+			if !ok {
+				a.auditAuth(r, "", "missing bearer token")
+				writeAuthError(w, "missing bearer token")
+				return
+			}
+
+			if !claims.HasScopes(scopes...) {
+				a.auditAuth(r, claims.Subject(), "insufficient scope")
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="api", error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+				render.Error(w, http.StatusForbidden, "insufficient scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/auth"
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+func signToken(t *testing.T, app *App, claims auth.Claims) string {
+	t.Helper()
+	return mustSign(t, claims, app.Config.JWT.Secret)
+}
+
+func mustSign(t *testing.T, claims auth.Claims, secret string) string {
+	t.Helper()
+
+	token, err := auth.Sign(claims, []byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+func TestJWTProtectedRoute(t *testing.T) {
+	app := NewApp()
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Valid token",
+			authorization:  "Bearer " + signToken(t, app, auth.NewClaims("user-42", time.Hour)),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Missing token",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "missing bearer token",
+		},
+		{
+			name:           "Wrong scheme",
+			authorization:  "Basic dXNlcjpwYXNz",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "missing bearer token",
+		},
+		{
+			name:           "Wrong secret",
+			authorization:  "Bearer " + mustSign(t, auth.NewClaims("user-42", time.Hour), "other-secret"),
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid token",
+		},
+		{
+			name:           "Expired token",
+			authorization:  "Bearer " + signToken(t, app, auth.NewClaims("user-42", -time.Minute)),
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "token expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/me", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			if tt.expectedError != "" {
+				assert.Equal(t, tt.expectedError, body["error"])
+			} else {
+				assert.Equal(t, "user-42", body["user_id"])
+			}
+		})
+	}
+}
+
+func TestMeHandlerWithoutClaims(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	rr := httptest.NewRecorder()
+	app.wrap(app.meHandler)(rr, httptest.NewRequest("GET", "/api/v1/me", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.JSONEq(t, `{"error": "unauthorized"}`, rr.Body.String())
+}
+
+func TestJWTPublicRoutesStayOpen(t *testing.T) {
+	app := NewApp()
+
+	for _, path := range []string{"/health", "/version", "/api/v1/status"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+
+		app.Router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+	}
+}
+
+func TestJWTClaimsInContext(t *testing.T) {
+	app := NewApp()
+	claims := auth.NewClaims("user-42", time.Hour)
+	claims["role"] = "admin"
+
+	var got auth.Claims
+	var userID interface{}
+	handler := app.jwtAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = claimsFromContext(r.Context())
+		userID = r.Context().Value(logger.UserIDKey)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, app, claims))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.NotNil(t, got)
+	assert.Equal(t, "admin", got["role"])
+	assert.Equal(t, "user-42", userID)
+}
+
+func TestRequireScopes(t *testing.T) {
+	app := NewApp()
+	app.Audit.SetOutput(io.Discard)
+
+	users := app.Protected("/api/v1/users")
+	users.Use(app.RequireScopes("users:write"))
+	users.Handle("POST", "", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	withScope := func(scope string) string {
+		claims := auth.NewClaims("user-42", time.Hour)
+		claims["scope"] = scope
+		return signToken(t, app, claims)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "Sufficient scopes", token: withScope("users:read users:write"), expectedStatus: http.StatusOK},
+		{name: "Insufficient scopes", token: withScope("users:read"), expectedStatus: http.StatusForbidden},
+		{name: "No scopes", token: signToken(t, app, auth.NewClaims("user-42", time.Hour)), expectedStatus: http.StatusForbidden},
+		{name: "No token", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/users", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.JSONEq(t, `{"error": "insufficient scope"}`, rr.Body.String())
+				assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `scope="users:write"`)
+			}
+		})
+	}
+}
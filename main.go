@@ -2,15 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/buildinfo"
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+	"github.com/darkcloud/beto/pkg/metrics"
+	"github.com/darkcloud/beto/pkg/render"
 )
 
 const (
@@ -21,17 +36,70 @@ const (
 
 // App represents the main application structure
 type App struct {
+	Config *config.Config
+
+	// configMu guards the fields of Config that Reload changes
+	configMu sync.RWMutex
+
+	// Router is where routes are registered; serve Handler instead
 	Router *mux.Router
 	Server *http.Server
-	Logger *log.Logger
+	Logger *logger.Logger
+
+	// TLSConfig overrides the default TLS settings used by StartTLS
+	TLSConfig *tls.Config
+
+	// Audit receives authentication attempts and admin configuration
+	// changes
+	Audit *logger.AuditLogger
+
+	limiter *rateLimiter
+	routes  *routeCache
+	metrics *metrics.HTTPMetrics
+
+	// idGen creates request IDs; tests may replace it for deterministic IDs
+	idGen IDGenerator
+
+	// middleware lists the middleware added with Use, outermost first.
+	// The recovery middleware is not included as it always comes first.
+	middleware []mux.MiddlewareFunc
+
+	hooksMu       sync.Mutex
+	shutdownHooks []func(context.Context) error
+
+	// notReady is set when shutdown begins so that /readyz fails
+	notReady atomic.Bool
+
+	listenMu sync.Mutex
+	listener net.Listener
+
+	// streaming holds the *mux.Route values registered with HandleStreaming
+	streaming sync.Map
 }
 
-// NewApp creates a new application instance
+// NewApp creates a new application instance with the default configuration
 func NewApp() *App {
+	return NewAppWithConfig(config.Default())
+}
+
+// NewAppWithConfig creates a new application instance using cfg
+func NewAppWithConfig(cfg *config.Config) *App {
 	app := &App{
+		Config: cfg,
 		Router: mux.NewRouter(),
-		Logger: log.New(os.Stdout, "[BETO] ", log.LstdFlags|log.Lshortfile),
+		Logger: logger.NewDefault(),
+		Audit:  logger.NewAudit(nil),
+		routes: newRouteCache(),
+		idGen:  uuidV7Generator{},
 	}
+	app.Logger.SetRedactFields(cfg.Logging.RedactFields)
+	app.Logger.SetLevel(logger.ParseLevel(cfg.Logging.Level))
+
+	limit := 0
+	if cfg.RateLimit.Enabled {
+		limit = cfg.RateLimit.RequestsPerWindow
+	}
+	app.limiter = newRateLimiter(limit, cfg.RateLimit.WindowDuration)
 
 	app.setupRoutes()
 	return app
@@ -39,66 +107,241 @@ func NewApp() *App {
 
 // setupRoutes configures all application routes
 func (a *App) setupRoutes() {
-	// Middleware (must be added before routes)
-	a.Router.Use(a.corsMiddleware)
-	a.Router.Use(a.loggingMiddleware)
+	// Recovery must be the outermost middleware, everything else is added
+	// inside it with Use
+	a.Router.Use(a.recoveryMiddleware)
 
-	// Health check endpoint
-	a.Router.HandleFunc("/health", a.healthHandler).Methods("GET", "OPTIONS")
+	// Middleware
+	if trusted, err := a.Config.Server.TrustedProxyPrefixes(); err != nil {
+		a.Logger.Error("Ignoring TRUSTED_PROXIES: %v", err)
+	} else if len(trusted) > 0 {
+		a.Use(a.clientIPMiddleware(trusted))
+	}
+	a.Use(a.securityHeadersMiddleware(a.Config.Security))
+	a.Use(a.corsMiddleware(a.Config.CORS))
+	a.Use(a.loggingMiddleware)
+	a.Use(a.requestIDMiddleware)
+	if a.Config.Metrics.Enabled {
+		a.metrics = metrics.NewHTTPMetrics("beto", nil)
+		a.Use(a.metricsMiddleware)
+		a.Handle("GET", "/metrics", a.metrics.Handler().ServeHTTP)
+	}
+	if threshold := a.Config.RateLimit.ClientErrorThreshold; threshold > 0 {
+		tracker := newClientErrorTracker(threshold, a.Config.RateLimit.ClientErrorWindow)
+		a.Use(a.clientErrorMiddleware(tracker))
+	}
+	a.Use(a.rateLimitMiddleware)
+	if a.Config.Server.HandlerTimeout > 0 {
+		a.Use(a.timeoutMiddleware(a.Config.Server.HandlerTimeout))
+	}
+	if limit, err := a.Config.FileUpload.MaxBytes(); err == nil {
+		a.Use(a.bodyLimitMiddleware(limit))
+	}
+	if a.Config.Server.RequireUserAgent {
+		a.RequireUserAgent()
+	}
+
+	// Health check endpoints: liveness and readiness for load balancers
+	a.Handle("GET", "/health", a.healthHandler)
+	a.Handle("GET", "/readyz", a.readyzHandler)
 
 	// Version endpoint
-	a.Router.HandleFunc("/version", a.versionHandler).Methods("GET", "OPTIONS")
+	a.Handle("GET", "/version", a.versionHandler)
 
 	// Root endpoint
-	a.Router.HandleFunc("/", a.rootHandler).Methods("GET", "OPTIONS")
+	a.Handle("GET", "/", a.rootHandler)
 
 	// API routes
-	api := a.Router.PathPrefix("/api/v1").Subrouter()
-	api.HandleFunc("/status", a.statusHandler).Methods("GET", "OPTIONS")
+	api := a.Group("/api/v1")
+	api.Handle("GET", "/status", a.statusHandler)
+	api.Handle("GET", "/openapi.json", a.openAPIHandler)
+	a.HandleStreaming("GET", "/api/v1/events", a.eventsHandler)
+
+	// WebSocket echo endpoint
+	if a.Config.Server.WebSocketEnabled {
+		a.Handle("GET", "/ws", a.wsEchoHandler(a.newUpgrader()))
+	}
+
+	// Authenticated routes
+	a.Protected("/api/v1/me").Handle("GET", "", a.wrap(a.meHandler))
+
+	a.setupAdminRoutes()
+
+	a.SetFallbackHandler(nil)
+	a.Router.MethodNotAllowedHandler = a.withMiddleware(http.HandlerFunc(a.methodNotAllowedHandler))
 }
 
 // HTTP Handlers
+type healthResponse struct {
+	XMLName   xml.Name `json:"-" xml:"health"`
+	Status    string   `json:"status" xml:"status"`
+	Timestamp string   `json:"timestamp" xml:"timestamp"`
+}
+
+type readinessResponse struct {
+	XMLName   xml.Name `json:"-" xml:"readiness"`
+	Status    string   `json:"status" xml:"status"`
+	Timestamp string   `json:"timestamp" xml:"timestamp"`
+}
+
+type memoryStats struct {
+	AllocBytes      uint64 `json:"alloc_bytes" xml:"alloc_bytes"`
+	TotalAllocBytes uint64 `json:"total_alloc_bytes" xml:"total_alloc_bytes"`
+	SysBytes        uint64 `json:"sys_bytes" xml:"sys_bytes"`
+	NumGC           uint64 `json:"num_gc" xml:"num_gc"`
+}
+
+type versionResponse struct {
+	XMLName   xml.Name    `json:"-" xml:"version"`
+	Name      string      `json:"name" xml:"name"`
+	Version   string      `json:"version" xml:"version"`
+	Commit    string      `json:"commit" xml:"commit"`
+	BuildTime string      `json:"build_time" xml:"build_time"`
+	GoVersion string      `json:"go_version" xml:"go_version"`
+	Memory    memoryStats `json:"memory" xml:"memory"`
+}
+
+type rootResponse struct {
+	XMLName xml.Name `json:"-" xml:"root"`
+	Message string   `json:"message" xml:"message"`
+	Version string   `json:"version" xml:"version"`
+}
+
+type statusResponse struct {
+	XMLName xml.Name `json:"-" xml:"status"`
+	API     string   `json:"api" xml:"api"`
+	Status  string   `json:"status" xml:"status"`
+	Uptime  string   `json:"uptime" xml:"uptime"`
+}
+
 func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status": "healthy", "timestamp": "%s"}`, time.Now().Format(time.RFC3339))
+	respond(w, r, http.StatusOK, healthResponse{
+		Status:    "healthy",
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
 }
 
+// readyzHandler reports whether the server should receive traffic. It
+// fails with 503 once shutdown has begun.
+func (a *App) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	status, code := "ready", http.StatusOK
+	if a.notReady.Load() {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	respond(w, r, code, readinessResponse{
+		Status:    status,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+// versionHandler reports build metadata and live memory statistics. The
+// memory numbers change constantly, so the response is never answered with
+// 304 Not Modified.
 func (a *App) versionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"name": "%s", "version": "%s"}`, appName, version)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	respond(w, r, http.StatusOK, versionResponse{
+		Name:      appName,
+		Version:   version,
+		Commit:    buildinfo.Commit,
+		BuildTime: buildinfo.BuildTime,
+		GoVersion: buildinfo.GoVersion(),
+		Memory: memoryStats{
+			AllocBytes:      mem.Alloc,
+			TotalAllocBytes: mem.TotalAlloc,
+			SysBytes:        mem.Sys,
+			NumGC:           uint64(mem.NumGC),
+		},
+	})
 }
 
 func (a *App) rootHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"message": "Welcome to %s API", "version": "%s"}`, appName, version)
+	respond(w, r, http.StatusOK, rootResponse{
+		Message: fmt.Sprintf("Welcome to %s API", appName),
+		Version: version,
+	})
 }
 
 func (a *App) statusHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"api": "v1", "status": "running", "uptime": "%s"}`, time.Since(startTime))
+	respond(w, r, http.StatusOK, statusResponse{
+		API:    "v1",
+		Status: "running",
+		Uptime: time.Since(startTime).String(),
+	})
 }
 
 // Middleware
 func (a *App) loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		a.Logger.Printf("%s %s %s %v", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
-	})
+	return a.Logger.HTTPLogMiddlewareWithOptions(logger.HTTPLogOptions{
+		LogRequestBody: a.Config.Logging.RequestBody,
+		MaxBodyBytes:   a.Config.Logging.RequestBodyMaxBytes,
+		AccessFormat:   a.Config.Logging.AccessFormat,
+		SlowThreshold:  a.Config.Server.SlowRequestThreshold,
+		ExcludePaths:   a.Config.Server.LogExcludePaths,
+		ClientIP:       ClientIP,
+	})(next)
 }
 
-func (a *App) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// corsMiddleware applies the CORS policy from cfg. The request Origin is
+// echoed back only when it is allowed; the wildcard "*" allows any origin
+// unless credentials are enabled, which browsers do not permit with "*".
+// Preflight OPTIONS requests are answered directly.
+func (a *App) corsMiddleware(cfg config.CORSConfig) mux.MiddlewareFunc {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	wildcard := cfg.AllowsAllOrigins() && !cfg.AllowCredentials
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+	var maxAge string
+	if cfg.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+
+			allowed := true
+			if wildcard {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Add("Vary", "Origin")
+				allowed = origin != "" && cfg.AllowsOrigin(origin)
+				if allowed {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					if cfg.AllowCredentials {
+						w.Header().Set("Access-Control-Allow-Credentials", "true")
+					}
+				}
+			}
+
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+
+			if r.Method == "OPTIONS" {
+				if allowed && maxAge != "" {
+					w.Header().Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			if allowed && exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// userAgentMiddleware rejects requests that do not identify their client
+func (a *App) userAgentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() == "" {
+			render.Error(w, http.StatusBadRequest, "User-Agent header is required")
 			return
 		}
 
@@ -106,57 +349,212 @@ func (a *App) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// Start initializes and starts the HTTP server
-func (a *App) Start(port string) error {
-	a.Server = &http.Server{
+// RequireUserAgent rejects requests without a User-Agent header with 400.
+// It is off by default and meant for APIs that require identifiable clients.
+func (a *App) RequireUserAgent() {
+	a.Use(a.userAgentMiddleware)
+}
+
+// defaultReadHeaderTimeout applies when Server.ReadHeaderTimeout is zero
+const defaultReadHeaderTimeout = 5 * time.Second
+
+// newServer creates the HTTP server for the given port using the
+// configured server timeouts
+func (a *App) newServer(port string) *http.Server {
+	readHeaderTimeout := a.Config.Server.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		// Never leave header reads unbounded, see ReadHeaderTimeout
+		readHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if readTimeout := a.Config.Server.ReadTimeout; readTimeout > 0 {
+		// net/http uses ReadHeaderTimeout instead of ReadTimeout while
+		// reading headers, so a longer value would loosen ReadTimeout
+		readHeaderTimeout = min(readHeaderTimeout, readTimeout)
+	}
+
+	return &http.Server{
 		Addr:         ":" + port,
-		Handler:      a.Router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Handler:      a.Handler(),
+		ReadTimeout:  a.Config.Server.ReadTimeout,
+		WriteTimeout: a.Config.Server.WriteTimeout,
+		IdleTimeout:  a.Config.Server.IdleTimeout,
+		ConnContext:  logger.ConnContext,
+
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+}
+
+// Start initializes and starts the HTTP server. Port "0" binds a random
+// free port, which Addr reports once the server is listening.
+func (a *App) Start(port string) error {
+	a.Server = a.newServer(port)
+	ln, err := a.listen()
+	if err != nil {
+		return err
 	}
 
-	a.Logger.Printf("Starting %s on port %s", appName, port)
-	return a.Server.ListenAndServe()
+	a.logStartup(listenPort(ln, port), false)
+	return a.Server.Serve(ln)
 }
 
-// Shutdown gracefully shuts down the server
+// listen binds the server's address and records the listener for Addr
+func (a *App) listen() (net.Listener, error) {
+	ln, err := net.Listen("tcp", a.Server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	a.setListener(ln)
+	return ln, nil
+}
+
+// setListener records ln for Addr
+func (a *App) setListener(ln net.Listener) {
+	a.listenMu.Lock()
+	a.listener = ln
+	a.listenMu.Unlock()
+}
+
+// Addr returns the address the server is listening on, or nil before it
+// has started listening. It is safe to call from another goroutine while
+// Start is running.
+func (a *App) Addr() net.Addr {
+	a.listenMu.Lock()
+	defer a.listenMu.Unlock()
+
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// listenPort returns the port ln is bound to, or port if it is not a TCP
+// listener
+func listenPort(ln net.Listener, port string) string {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		return strconv.Itoa(addr.Port)
+	}
+	return port
+}
+
+// logStartup records the effective configuration of this instance in a
+// single entry. Only fields of the redacted config are logged, so secrets
+// cannot leak if the summary grows.
+func (a *App) logStartup(port string, tls bool) {
+	a.startupLogger(tls).WithField("port", port).Info("Starting %s on port %s", appName, port)
+}
+
+// startupLogger returns the app logger with the configuration summary
+// logged by logStartup
+func (a *App) startupLogger(tls bool) *logger.Logger {
+	cfg := a.Config.Redacted()
+
+	return a.Logger.WithFields(map[string]interface{}{
+		"environment":         cfg.Environment,
+		"log_level":           cfg.Logging.Level,
+		"cors_origins":        len(cfg.CORS.AllowedOrigins),
+		"rate_limit_enabled":  cfg.RateLimit.Enabled,
+		"rate_limit_requests": cfg.RateLimit.RequestsPerWindow,
+		"rate_limit_window":   cfg.RateLimit.WindowDuration.String(),
+		"tls":                 tls,
+	})
+}
+
+// Shutdown gracefully shuts down the server and then runs the hooks
+// registered with OnShutdown. It first marks the app not ready on /readyz
+// and, when the server is running, waits Server.PreShutdownDelay so load
+// balancers stop sending traffic before connections are drained. The delay
+// ends early if ctx is done. The returned error joins the server error
+// with any hook errors.
 func (a *App) Shutdown(ctx context.Context) error {
-	a.Logger.Println("Shutting down server...")
-	return a.Server.Shutdown(ctx)
+	a.Logger.Info("Shutting down server...")
+	a.notReady.Store(true)
+
+	var err error
+	if a.Server != nil {
+		if delay := a.Config.Server.PreShutdownDelay; delay > 0 {
+			a.Logger.WithField("delay", delay.String()).Info("Marked not ready, waiting before draining connections")
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+
+		a.Logger.Info("Draining connections")
+		err = a.Server.Shutdown(ctx)
+	}
+
+	a.Logger.Info("Running shutdown hooks")
+	return errors.Join(err, a.runShutdownHooks(ctx))
 }
 
 var startTime = time.Now()
 
 func main() {
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and connections, then exit without starting the server")
+	flag.Parse()
+
+	if *checkConfig {
+		// runSelfCheck validates the configuration itself so that invalid
+		// settings are reported together with unreachable services
+		cfg, loadErr := config.LoadUnvalidated()
+		if err := errors.Join(loadErr, runSelfCheck(cfg)); err != nil {
+			logger.Fatal("Self-check failed: %v", err)
+		}
+		logger.Info("Self-check passed")
+		return
 	}
 
+	// Load and validate configuration from the environment
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatal("Failed to load configuration: %v", err)
+	}
+	port := cfg.Port
+
 	// Create application instance
-	app := NewApp()
+	app := NewAppWithConfig(cfg)
 
-	// Start server in a goroutine
+	// Start server in a goroutine, serving on a Unix socket when one is
+	// configured, HTTPS when a certificate is configured and h2c when
+	// enabled
 	go func() {
-		if err := app.Start(port); err != nil && err != http.ErrServerClosed {
-			app.Logger.Fatalf("Server failed to start: %v", err)
+		start := func() error { return app.Start(port) }
+		if cfg.Server.UnixSocket != "" {
+			start = func() error { return app.StartUnix(cfg.Server.UnixSocket) }
+		} else if cfg.Server.TLSEnabled() {
+			start = func() error { return app.StartTLS(port, cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile) }
+		} else if cfg.Server.H2CEnabled {
+			start = func() error { return app.StartH2C(port) }
+		}
+
+		if err := start(); err != nil && err != http.ErrServerClosed {
+			app.Logger.Fatal("Server failed to start: %v", err)
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Reload the live settings on SIGHUP and shut down gracefully on
+	// SIGINT or SIGTERM
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	handleSignals(signals, func() {
+		cfg, err := config.Load()
+		if err != nil {
+			app.Logger.Error("Ignoring config reload: %v", err)
+			return
+		}
+		app.Reload(cfg)
+	})
 
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Graceful shutdown with the configured timeout, after the pre-shutdown
+	// delay
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.PreShutdownDelay+cfg.Server.GracefulTimeout)
 	defer cancel()
 
 	if err := app.Shutdown(ctx); err != nil {
-		app.Logger.Fatalf("Server forced to shutdown: %v", err)
+		app.Logger.Fatal("Server forced to shutdown: %v", err)
 	}
 
-	app.Logger.Println("Server exited")
+	app.Logger.Info("Server exited")
 }
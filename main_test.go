@@ -4,14 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"runtime"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/buildinfo"
+	"github.com/darkcloud/beto/pkg/config"
 )
 
 func TestNewApp(t *testing.T) {
@@ -53,12 +60,21 @@ func TestVersionHandler(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 
-	var response map[string]string
+	var response map[string]interface{}
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	require.NoError(t, err)
 
 	assert.Equal(t, appName, response["name"])
 	assert.Equal(t, version, response["version"])
+	assert.Equal(t, buildinfo.Commit, response["commit"])
+	assert.Equal(t, buildinfo.BuildTime, response["build_time"])
+	assert.Equal(t, runtime.Version(), response["go_version"])
+
+	memory, ok := response["memory"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Greater(t, memory["sys_bytes"], float64(0))
+	assert.Contains(t, memory, "alloc_bytes")
+	assert.Contains(t, memory, "num_gc")
 }
 
 func TestRootHandler(t *testing.T) {
@@ -100,6 +116,38 @@ func TestStatusHandler(t *testing.T) {
 	assert.NotEmpty(t, response["uptime"])
 }
 
+func TestLogStartup(t *testing.T) {
+	cfg := config.Default()
+	cfg.Environment = "staging"
+	cfg.CORS.AllowedOrigins = []string{"https://a.example.com", "https://b.example.com"}
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.RequestsPerWindow = 50
+	cfg.RateLimit.WindowDuration = time.Minute
+	cfg.JWT.Secret = "super-secret"
+	app := NewAppWithConfig(cfg)
+
+	var buf bytes.Buffer
+	app.Logger.SetOutput(&buf)
+	app.logStartup("9090", true)
+
+	var entry struct {
+		Message string                 `json:"message"`
+		Fields  map[string]interface{} `json:"fields"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+
+	assert.Equal(t, "Starting "+appName+" on port 9090", entry.Message)
+	assert.Equal(t, "9090", entry.Fields["port"])
+	assert.Equal(t, "staging", entry.Fields["environment"])
+	assert.Equal(t, cfg.Logging.Level, entry.Fields["log_level"])
+	assert.Equal(t, float64(2), entry.Fields["cors_origins"])
+	assert.Equal(t, true, entry.Fields["rate_limit_enabled"])
+	assert.Equal(t, float64(50), entry.Fields["rate_limit_requests"])
+	assert.Equal(t, "1m0s", entry.Fields["rate_limit_window"])
+	assert.Equal(t, true, entry.Fields["tls"])
+	assert.NotContains(t, buf.String(), "super-secret")
+}
+
 func TestLoggingMiddleware(t *testing.T) {
 	app := NewApp()
 
@@ -163,26 +211,305 @@ func TestCORSMiddleware(t *testing.T) {
 	}
 }
 
+func TestCORSMiddlewareWithConfig(t *testing.T) {
+	tests := []struct {
+		name                string
+		cors                config.CORSConfig
+		method              string
+		origin              string
+		expectedOrigin      string
+		expectedCredentials string
+		expectMethods       bool
+	}{
+		{
+			name:           "Allowed origin",
+			cors:           config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{"GET"}},
+			method:         "GET",
+			origin:         "https://app.example.com",
+			expectedOrigin: "https://app.example.com",
+			expectMethods:  true,
+		},
+		{
+			name:           "Disallowed origin",
+			cors:           config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{"GET"}},
+			method:         "GET",
+			origin:         "https://evil.example.com",
+			expectedOrigin: "",
+			expectMethods:  false,
+		},
+		{
+			name:           "Disallowed origin preflight",
+			cors:           config.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{"GET"}},
+			method:         "OPTIONS",
+			origin:         "https://evil.example.com",
+			expectedOrigin: "",
+			expectMethods:  false,
+		},
+		{
+			name: "Credentials mode",
+			cors: config.CORSConfig{
+				AllowedOrigins:   []string{"https://app.example.com"},
+				AllowedMethods:   []string{"GET", "POST"},
+				AllowCredentials: true,
+			},
+			method:              "OPTIONS",
+			origin:              "https://app.example.com",
+			expectedOrigin:      "https://app.example.com",
+			expectedCredentials: "true",
+			expectMethods:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.CORS = tt.cors
+			app := NewAppWithConfig(cfg)
+
+			req, err := http.NewRequest(tt.method, "/health", nil)
+			require.NoError(t, err)
+			req.Header.Set("Origin", tt.origin)
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.expectedOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.expectedCredentials, rr.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+			if tt.expectMethods {
+				assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), "GET")
+			} else {
+				assert.Empty(t, rr.Header().Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
+
+func TestCORSMaxAgeAndExposedHeaders(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		origin          string
+		expectedMaxAge  string
+		expectedExposed string
+	}{
+		{name: "Preflight", method: "OPTIONS", origin: "https://app.example.com", expectedMaxAge: "600"},
+		{name: "Actual request", method: "GET", origin: "https://app.example.com", expectedExposed: "X-Request-ID, X-Total-Count"},
+		{name: "Disallowed preflight", method: "OPTIONS", origin: "https://evil.example.com"},
+		{name: "Disallowed request", method: "GET", origin: "https://evil.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.CORS = config.CORSConfig{
+				AllowedOrigins: []string{"https://app.example.com"},
+				AllowedMethods: []string{"GET"},
+				MaxAge:         10 * time.Minute,
+				ExposedHeaders: []string{"X-Request-ID", "X-Total-Count"},
+			}
+			app := NewAppWithConfig(cfg)
+			app.Logger.SetOutput(io.Discard)
+
+			req, err := http.NewRequest(tt.method, "/health", nil)
+			require.NoError(t, err)
+			req.Header.Set("Origin", tt.origin)
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.expectedMaxAge, rr.Header().Get("Access-Control-Max-Age"))
+			assert.Equal(t, tt.expectedExposed, rr.Header().Get("Access-Control-Expose-Headers"))
+		})
+	}
+}
+
+func TestCORSDefaultsOmitMaxAgeAndExposedHeaders(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	for _, method := range []string{"OPTIONS", "GET"} {
+		req, err := http.NewRequest(method, "/health", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+
+		assert.Empty(t, rr.Header().Values("Access-Control-Max-Age"), method)
+		assert.Empty(t, rr.Header().Values("Access-Control-Expose-Headers"), method)
+	}
+}
+
+func TestRequireUserAgent(t *testing.T) {
+	app := NewApp()
+	app.RequireUserAgent()
+
+	tests := []struct {
+		name           string
+		userAgent      string
+		expectedStatus int
+	}{
+		{
+			name:           "With User-Agent",
+			userAgent:      "beto-client/1.0",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Without User-Agent",
+			userAgent:      "",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/health", nil)
+			require.NoError(t, err)
+			req.Header.Set("User-Agent", tt.userAgent)
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestUserAgentNotRequiredByDefault(t *testing.T) {
+	app := NewApp()
+	req, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+// waitForAddr waits until app is listening and returns its address
+func waitForAddr(t *testing.T, app *App) string {
+	t.Helper()
+
+	require.Eventually(t, func() bool { return app.Addr() != nil }, 2*time.Second, time.Millisecond)
+	return app.Addr().String()
+}
+
 func TestAppStartAndShutdown(t *testing.T) {
 	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
 
 	// Start server in background
+	errCh := make(chan error, 1)
 	go func() {
-		err := app.Start("0") // Use port 0 to get any available port
-		if err != nil && err != http.ErrServerClosed {
-			t.Errorf("Server failed to start: %v", err)
-		}
+		errCh <- app.Start("0") // Use port 0 to get any available port
 	}()
 
-	// Give the server a moment to start
-	time.Sleep(100 * time.Millisecond)
+	addr := waitForAddr(t, app)
+	assert.NotEqual(t, 0, app.Addr().(*net.TCPAddr).Port, "Addr reports the port that was chosen")
+
+	resp, err := http.Get("http://" + addr + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
 	// Test shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := app.Shutdown(ctx)
-	assert.NoError(t, err)
+	require.NoError(t, app.Shutdown(ctx))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+}
+
+func TestAppStartPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	assert.Error(t, app.Start(port))
+	assert.Nil(t, app.Addr())
+}
+
+func TestServerUsesConfiguredTimeouts(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.ReadTimeout = 100 * time.Millisecond
+	cfg.Server.WriteTimeout = 2 * time.Second
+	cfg.Server.IdleTimeout = 3 * time.Second
+	app := NewAppWithConfig(cfg)
+
+	server := app.newServer("0")
+	assert.Equal(t, 100*time.Millisecond, server.ReadTimeout)
+	assert.Equal(t, 2*time.Second, server.WriteTimeout)
+	assert.Equal(t, 3*time.Second, server.IdleTimeout)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Send an incomplete request and stall; the server must give up on it
+	_, err = conn.Write([]byte("GET /health HTTP/1.1\r\nHost: localhost\r\n"))
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err, "the server should close the connection rather than the client timing out")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestServerReadHeaderTimeout(t *testing.T) {
+	app := NewApp()
+	assert.Equal(t, 5*time.Second, app.newServer("0").ReadHeaderTimeout, "set by default")
+
+	cfg := config.Default()
+	cfg.Server.ReadHeaderTimeout = 0
+	app = NewAppWithConfig(cfg)
+	assert.Equal(t, defaultReadHeaderTimeout, app.newServer("0").ReadHeaderTimeout, "zero never disables it")
+
+	cfg = config.Default()
+	cfg.Server.ReadTimeout = time.Second
+	cfg.Server.ReadHeaderTimeout = time.Minute
+	app = NewAppWithConfig(cfg)
+	assert.Equal(t, time.Second, app.newServer("0").ReadHeaderTimeout, "capped at ReadTimeout")
+
+	cfg = config.Default()
+	cfg.Server.ReadTimeout = time.Minute
+	cfg.Server.ReadHeaderTimeout = 100 * time.Millisecond
+	app = NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+
+	server := app.newServer("0")
+	assert.Equal(t, 100*time.Millisecond, server.ReadHeaderTimeout)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Trickle headers like a Slowloris client; the connection is dropped
+	// long before the one minute ReadTimeout
+	_, err = conn.Write([]byte("GET /health HTTP/1.1\r\nHost: localhost\r\n"))
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
 }
 
 func TestEnvironmentVariables(t *testing.T) {
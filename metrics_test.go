@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := config.Default()
+	cfg.Metrics.Enabled = true
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Handle("GET", "/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/api/v1/status", "/users/1", "/users/2"} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		app.Router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/plain")
+
+	body := rr.Body.String()
+	assert.Contains(t, body, `beto_http_requests_total{method="GET",path="/api/v1/status",status="200"} 1`)
+	assert.Contains(t, body, `beto_http_requests_total{method="GET",path="/users/{id}",status="404"} 2`)
+	assert.Contains(t, body, `beto_http_request_duration_seconds_count{method="GET",path="/users/{id}",status="404"} 2`)
+	assert.Contains(t, body, "beto_http_requests_in_flight 1", "the scrape itself is in flight")
+	assert.NotContains(t, body, "/users/1")
+}
+
+func TestMetricsDisabledByDefault(t *testing.T) {
+	app := NewApp()
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestMetricsExemplars(t *testing.T) {
+	const trace = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	cfg := config.Default()
+	cfg.Metrics.Enabled = true
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+
+	req, err := http.NewRequest("GET", "/api/v1/status", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-"+trace+"-00f067aa0ba902b7-01")
+	app.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, err = http.NewRequest("GET", "/metrics", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "application/openmetrics-text")
+
+	body := rr.Body.String()
+	assert.Regexp(t, `beto_http_request_duration_seconds_bucket\{method="GET",path="/api/v1/status",status="200",le="[^"]+"\} 1 # \{trace_id="`+trace+`"\} \S+ \S+\n`, body)
+	assert.Contains(t, body, "# TYPE beto_http_requests counter\n")
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+
+	// The Prometheus text format has no exemplar syntax
+	req, err = http.NewRequest("GET", "/metrics", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	assert.NotContains(t, rr.Body.String(), trace)
+}
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		expected    string
+	}{
+		{name: "Valid", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expected: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "Missing", traceparent: "", expected: ""},
+		{name: "Malformed", traceparent: "00-abc-01", expected: ""},
+		{name: "Uppercase", traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", expected: ""},
+		{name: "All zeros", traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			assert.Equal(t, tt.expected, traceID(req))
+		})
+	}
+}
+
+func TestLogExcludePathsStillCountedInMetrics(t *testing.T) {
+	cfg := config.Default()
+	cfg.Metrics.Enabled = true
+	cfg.Server.LogExcludePaths = []string{"/health", "/metrics"}
+	app := NewAppWithConfig(cfg)
+	out := &syncBuffer{}
+	app.Logger.SetOutput(out)
+
+	for _, path := range []string{"/health", "/health", "/api/v1/status"} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		app.Router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	logs := out.String()
+	assert.NotContains(t, logs, `"url":"/health"`)
+	assert.Contains(t, logs, `"url":"/api/v1/status"`)
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	assert.Contains(t, rr.Body.String(), `beto_http_requests_total{method="GET",path="/health",status="200"} 2`)
+}
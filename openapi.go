@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// openAPIVersion is the version of the OpenAPI specification emitted
+const openAPIVersion = "3.0.3"
+
+// openAPIDocument is a minimal OpenAPI 3 document: paths and methods, with
+// path parameters and a generic JSON response but no request or response
+// models
+type openAPIDocument struct {
+	OpenAPI string                                 `json:"openapi"`
+	Info    openAPIInfo                            `json:"info"`
+	Paths   map[string]map[string]openAPIOperation `json:"paths"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	OperationID string                 `json:"operationId,omitempty"`
+	Parameters  []openAPIParameter     `json:"parameters,omitempty"`
+	Responses   map[string]interface{} `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+// openAPIResponses is the generic response of every operation
+var openAPIResponses = map[string]interface{}{
+	"default": map[string]interface{}{
+		"description": "JSON response",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"type": "object"},
+			},
+		},
+	},
+}
+
+// anyMethods are documented for routes that accept any method
+var anyMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// pathVariable matches a mux path variable with an optional pattern, as in
+// {id} or {id:[0-9]+}
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// openAPIHandler describes the routes registered at the time of the request
+// as an OpenAPI document
+func (a *App) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, http.StatusOK, a.openAPI())
+}
+
+// openAPI builds the OpenAPI document from Routes
+func (a *App) openAPI() openAPIDocument {
+	doc := openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: appName, Version: version},
+		Paths:   make(map[string]map[string]openAPIOperation),
+	}
+
+	for _, route := range a.Routes() {
+		// OpenAPI has no notion of variable patterns
+		path := pathVariable.ReplaceAllString(route.Path, "{$1}")
+
+		var params []openAPIParameter
+		for _, match := range pathVariable.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, openAPIParameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   map[string]interface{}{"type": "string"},
+			})
+		}
+
+		methods := []string{route.Method}
+		if route.Method == "*" {
+			methods = anyMethods
+		}
+
+		operations := doc.Paths[path]
+		if operations == nil {
+			operations = make(map[string]openAPIOperation)
+			doc.Paths[path] = operations
+		}
+		for _, method := range methods {
+			operations[strings.ToLower(method)] = openAPIOperation{
+				OperationID: route.Name,
+				Parameters:  params,
+				Responses:   openAPIResponses,
+			}
+		}
+	}
+	return doc
+}
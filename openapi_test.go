@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	app := NewApp()
+	app.Group("/api/v2").Handle("DELETE", "/items/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {}).Name("delete-item")
+
+	req, err := http.NewRequest("GET", "/api/v1/openapi.json", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+			Responses map[string]interface{} `json:"responses"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, appName, doc.Info.Title)
+	require.Contains(t, doc.Paths, "/health")
+	require.Contains(t, doc.Paths, "/api/v1/status")
+	assert.Contains(t, doc.Paths["/health"], "get")
+	assert.Contains(t, doc.Paths["/health"]["get"].Responses, "default")
+	assert.Contains(t, doc.Paths, "/api/v1/openapi.json", "the document describes itself")
+
+	// Routes added at runtime are included, with mux patterns removed
+	require.Contains(t, doc.Paths, "/api/v2/items/{id}")
+	item := doc.Paths["/api/v2/items/{id}"]["delete"]
+	assert.Equal(t, "delete-item", item.OperationID)
+	require.Len(t, item.Parameters, 1)
+	assert.Equal(t, "id", item.Parameters[0].Name)
+	assert.Equal(t, "path", item.Parameters[0].In)
+	assert.True(t, item.Parameters[0].Required)
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed or incorrectly signed tokens
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrExpiredToken is returned for tokens past their expiry or not yet valid
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// header is the only JOSE header accepted and produced
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims holds the payload of a JWT
+type Claims map[string]interface{}
+
+// NewClaims returns claims for subject expiring after expiry
+func NewClaims(subject string, expiry time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(expiry).Unix(),
+	}
+}
+
+// Subject returns the user_id claim, falling back to the standard sub claim
+func (c Claims) Subject() string {
+	if userID, ok := c["user_id"].(string); ok && userID != "" {
+		return userID
+	}
+	subject, _ := c["sub"].(string)
+	return subject
+}
+
+// Scopes returns the granted scopes from the space-separated scope claim
+// and the scopes claim, which may be a list or a space-separated string
+func (c Claims) Scopes() []string {
+	var scopes []string
+	for _, key := range []string{"scope", "scopes"} {
+		switch v := c[key].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(v)...)
+		case []interface{}:
+			for _, scope := range v {
+				if s, ok := scope.(string); ok && s != "" {
+					scopes = append(scopes, s)
+				}
+			}
+		case []string:
+			scopes = append(scopes, v...)
+		}
+	}
+	return scopes
+}
+
+// HasScopes reports whether every one of required was granted
+func (c Claims) HasScopes(required ...string) bool {
+	granted := make(map[string]bool)
+	for _, scope := range c.Scopes() {
+		granted[scope] = true
+	}
+	for _, scope := range required {
+		if !granted[scope] {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpiresAt returns the exp claim
+func (c Claims) ExpiresAt() (time.Time, bool) {
+	return c.time("exp")
+}
+
+// time returns a NumericDate claim
+func (c Claims) time(key string) (time.Time, bool) {
+	switch v := c[key].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// Sign encodes claims as an HS256 JWT signed with secret
+func Sign(claims Claims, secret []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encoding claims: %w", err)
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signature(unsigned, secret), nil
+}
+
+// Parse verifies an HS256 JWT against secret and returns its claims. Tokens
+// must carry an exp claim; exp and nbf are checked against now.
+func Parse(token string, secret []byte, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected three segments", ErrInvalidToken)
+	}
+
+	// Only HS256 is accepted, which rules out "none" and algorithm confusion
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	var jose struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &jose); err != nil || jose.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm", ErrInvalidToken)
+	}
+
+	expected := signature(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+
+	expires, ok := claims.ExpiresAt()
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if !now.Before(expires) {
+		return nil, ErrExpiredToken
+	}
+	if notBefore, ok := claims.time("nbf"); ok && now.Before(notBefore) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrExpiredToken)
+	}
+
+	return claims, nil
+}
+
+// signature returns the base64url HMAC-SHA256 of data
+func signature(data string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
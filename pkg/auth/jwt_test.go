@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("test-secret")
+
+func TestSignAndParse(t *testing.T) {
+	claims := NewClaims("user-42", time.Hour)
+	claims["role"] = "admin"
+
+	token, err := Sign(claims, secret)
+	require.NoError(t, err)
+
+	parsed, err := Parse(token, secret, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "user-42", parsed.Subject())
+	assert.Equal(t, "admin", parsed["role"])
+}
+
+func TestParseRejectsInvalidTokens(t *testing.T) {
+	valid, err := Sign(NewClaims("user-42", time.Hour), secret)
+	require.NoError(t, err)
+	expired, err := Sign(NewClaims("user-42", -time.Minute), secret)
+	require.NoError(t, err)
+	noExpiry, err := Sign(Claims{"sub": "user-42"}, secret)
+	require.NoError(t, err)
+	notYet, err := Sign(Claims{"sub": "user-42", "exp": time.Now().Add(2 * time.Hour).Unix(), "nbf": time.Now().Add(time.Hour).Unix()}, secret)
+	require.NoError(t, err)
+
+	parts := strings.Split(valid, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+
+	tests := []struct {
+		name     string
+		token    string
+		secret   []byte
+		expected error
+	}{
+		{name: "Wrong secret", token: valid, secret: []byte("other"), expected: ErrInvalidToken},
+		{name: "Malformed", token: "not-a-token", secret: secret, expected: ErrInvalidToken},
+		{name: "Tampered payload", token: parts[0] + "." + parts[1] + "x." + parts[2], secret: secret, expected: ErrInvalidToken},
+		{name: "Algorithm none", token: none, secret: secret, expected: ErrInvalidToken},
+		{name: "Missing expiry", token: noExpiry, secret: secret, expected: ErrInvalidToken},
+		{name: "Expired", token: expired, secret: secret, expected: ErrExpiredToken},
+		{name: "Not valid yet", token: notYet, secret: secret, expected: ErrExpiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.token, tt.secret, time.Now())
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
+
+func TestClaimsSubject(t *testing.T) {
+	assert.Equal(t, "u1", Claims{"user_id": "u1", "sub": "s1"}.Subject())
+	assert.Equal(t, "s1", Claims{"sub": "s1"}.Subject())
+	assert.Equal(t, "", Claims{}.Subject())
+}
+
+func TestClaimsScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   Claims
+		expected []string
+	}{
+		{name: "Scope string", claims: Claims{"scope": "users:read users:write"}, expected: []string{"users:read", "users:write"}},
+		{name: "Scopes list", claims: Claims{"scopes": []interface{}{"users:read", "admin"}}, expected: []string{"users:read", "admin"}},
+		{name: "Both", claims: Claims{"scope": "a", "scopes": []string{"b"}}, expected: []string{"a", "b"}},
+		{name: "None", claims: Claims{}, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.claims.Scopes())
+		})
+	}
+
+	claims := Claims{"scope": "users:read users:write"}
+	assert.True(t, claims.HasScopes("users:write"))
+	assert.True(t, claims.HasScopes())
+	assert.False(t, claims.HasScopes("users:write", "admin"))
+}
@@ -0,0 +1,19 @@
+// Package buildinfo holds metadata injected at build time with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/darkcloud/beto/pkg/buildinfo.Commit=$(git rev-parse --short HEAD)"
+package buildinfo
+
+import "runtime"
+
+var (
+	// Commit is the git commit the binary was built from
+	Commit = "unknown"
+
+	// BuildTime is when the binary was built, in RFC 3339 format
+	BuildTime = "unknown"
+)
+
+// GoVersion returns the Go version the binary was built with
+func GoVersion() string {
+	return runtime.Version()
+}
@@ -1,12 +1,19 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"github.com/darkcloud/beto/pkg/logger"
 )
 
 // Config holds all configuration values for the application
@@ -32,12 +39,18 @@ type Config struct {
 	// CORS settings
 	CORS CORSConfig
 
+	// Security headers
+	Security SecurityConfig
+
 	// Rate limiting
 	RateLimit RateLimitConfig
 
 	// Logging
 	Logging LoggingConfig
 
+	// Metrics
+	Metrics MetricsConfig
+
 	// External APIs
 	ExternalAPIs ExternalAPIConfig
 
@@ -75,25 +88,144 @@ type ServerConfig struct {
 	WriteTimeout    time.Duration
 	IdleTimeout     time.Duration
 	GracefulTimeout time.Duration
+
+	// ReadHeaderTimeout bounds how long a client may take to send the
+	// request headers. It defends against Slowloris attacks, where a client
+	// opens many connections and trickles header bytes to keep each one
+	// open, exhausting the server's connections without ever completing a
+	// request. It is shorter than ReadTimeout, which also covers the body.
+	// Zero means the server's default of 5s rather than no limit. It is
+	// capped at ReadTimeout.
+	ReadHeaderTimeout time.Duration
+
+	// PreShutdownDelay is how long shutdown reports the server as not ready
+	// on /readyz before it stops accepting connections, giving load
+	// balancers time to stop routing traffic to it. Zero skips the delay.
+	PreShutdownDelay time.Duration
+
+	// HandlerTimeout bounds how long a handler may run before the client
+	// receives a 503. Zero disables the limit.
+	HandlerTimeout time.Duration
+
+	// SlowRequestThreshold makes the access log record requests that take
+	// longer than it at WARN. Zero disables the check.
+	SlowRequestThreshold time.Duration
+
+	// LogExcludePaths lists paths, and the paths below them, that are left
+	// out of the access log, such as /health and /metrics. They are still
+	// counted in metrics.
+	LogExcludePaths []string
+
+	// RequireUserAgent rejects requests without a User-Agent header
+	RequireUserAgent bool
+
+	// AdminToken guards the /admin endpoints, which are disabled when empty
+	AdminToken string
+
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// H2CEnabled serves HTTP/2 over cleartext alongside HTTP/1.1 when TLS
+	// is not configured, for proxies that speak h2c to the backend
+	H2CEnabled bool
+
+	// UnixSocket, when set, makes the server listen on a Unix domain
+	// socket at this path instead of PORT, for a reverse proxy on the same
+	// host. TLS and h2c settings do not apply to it.
+	UnixSocket string
+
+	// TrustedProxies lists the CIDRs, or single IPs, of the reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are believed when
+	// determining the client IP. The headers of any other peer are ignored
+	// so clients cannot spoof their address. Empty trusts no proxy.
+	TrustedProxies []string
+
+	// AllowProfilingInProduction lets App.EnableProfiling register the
+	// pprof endpoints in production
+	AllowProfilingInProduction bool
+
+	// WebSocketEnabled registers the /ws echo endpoint
+	WebSocketEnabled bool
+
+	// TrailingSlash controls requests whose path only differs from a route
+	// by a trailing slash: "strict" answers 404, "redirect" redirects to
+	// the route and "ignore" serves the route directly
+	TrailingSlash string
 }
 
 // CORSConfig holds CORS configuration
 type CORSConfig struct {
-	AllowedOrigins []string
-	AllowedMethods []string
-	AllowedHeaders []string
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+
+	// AllowWildcard permits the "*" origin in production, where it is
+	// otherwise rejected
+	AllowWildcard bool
+
+	// MaxAge is how long browsers may cache a preflight response, sent as
+	// Access-Control-Max-Age. Zero omits the header.
+	MaxAge time.Duration
+
+	// ExposedHeaders lists response headers that browsers let scripts read,
+	// sent as Access-Control-Expose-Headers
+	ExposedHeaders []string
+}
+
+// SecurityConfig holds the security headers sent on every response
+type SecurityConfig struct {
+	// ContentTypeNosniff sends X-Content-Type-Options: nosniff
+	ContentTypeNosniff bool
+
+	// FrameOptions is sent as X-Frame-Options, DENY or SAMEORIGIN. Empty
+	// omits the header.
+	FrameOptions string
+
+	// ReferrerPolicy is sent as Referrer-Policy. Empty omits the header.
+	ReferrerPolicy string
+
+	// HSTSMaxAge is sent as the max-age of Strict-Transport-Security on
+	// responses served over TLS, never over plain HTTP. Zero omits the
+	// header.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
 }
 
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
+	Enabled           bool
 	RequestsPerWindow int
 	WindowDuration    time.Duration
+
+	// ClientErrorThreshold is the number of 4xx responses a client may
+	// receive within ClientErrorWindow before a warning is logged. Zero
+	// disables tracking.
+	ClientErrorThreshold int
+	ClientErrorWindow    time.Duration
 }
 
 // LoggingConfig holds logging configuration
 type LoggingConfig struct {
 	Level  string
 	Format string
+
+	// RequestBody adds JSON and text request bodies, up to
+	// RequestBodyMaxBytes, to the access log
+	RequestBody         bool
+	RequestBodyMaxBytes int
+
+	// RedactFields are masked in log fields and logged request bodies
+	RedactFields []string
+
+	// AccessFormat is json, common or combined
+	AccessFormat string
+}
+
+// MetricsConfig holds metrics configuration
+type MetricsConfig struct {
+	Enabled bool
 }
 
 // ExternalAPIConfig holds external API configuration
@@ -110,74 +242,333 @@ type FileUploadConfig struct {
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
+	return LoadWithPrefix("")
+}
+
+// LoadWithPrefix loads configuration like Load, but looks up every key with
+// prefix prepended first, falling back to the unprefixed key. For example,
+// with prefix "TENANT1_", DB_HOST is read from TENANT1_DB_HOST if it is set
+// and from DB_HOST otherwise. This allows several configurations to be
+// loaded in one process.
+func LoadWithPrefix(prefix string) (*Config, error) {
+	loadDotEnv()
+	return load(&source{prefix: prefix})
+}
+
+// LoadUnvalidated loads configuration from the environment like Load but
+// does not call Validate, for a self-check that reports validation problems
+// together with its other checks. The returned Config is never nil: values
+// that fail to parse are reported in the error and left at their defaults.
+func LoadUnvalidated() (*Config, error) {
+	loadDotEnv()
+	s := &source{}
+	config := s.build()
+	if len(s.errs) > 0 {
+		return config, fmt.Errorf("invalid configuration: %w", errors.Join(s.errs...))
+	}
+	return config, nil
+}
+
+// LoadFromFile loads configuration from a YAML or JSON file whose keys mirror
+// the environment variable names, e.g. PORT or DB_HOST. Environment variables
+// take precedence over values from the file. A missing file is not an error:
+// configuration then comes from the environment and defaults alone.
+func LoadFromFile(path string) (*Config, error) {
+	loadDotEnv()
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return load(&source{file: values})
+}
+
+// dotEnvKeys records the variables that loadDotEnv set from .env, as
+// opposed to variables from the real environment
+var (
+	dotEnvMu   sync.Mutex
+	dotEnvKeys = make(map[string]bool)
+)
+
+// loadDotEnv sets variables from the .env file that are not already set in
+// the environment. Variables it set on an earlier call are updated, so a
+// config reload picks up edits to .env.
+func loadDotEnv() {
+	values, err := godotenv.Read()
+	if err != nil {
 		// It's okay if .env doesn't exist in production
 		fmt.Printf("Warning: Could not load .env file: %v\n", err)
+		return
+	}
+
+	dotEnvMu.Lock()
+	defer dotEnvMu.Unlock()
+
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set && !dotEnvKeys[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		dotEnvKeys[key] = true
+	}
+}
+
+// Default returns the built-in default configuration without consulting
+// the environment or any config file
+func Default() *Config {
+	return (&source{ignoreEnv: true}).build()
+}
+
+// load builds a validated Config from the given source
+func load(s *source) (*Config, error) {
+	config := s.build()
+
+	if len(s.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(s.errs...))
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
-	config := &Config{
-		Port:        getEnv("PORT", "8080"),
-		AppName:     getEnv("APP_NAME", "Beto Application"),
-		AppVersion:  getEnv("APP_VERSION", "1.0.0"),
-		Environment: getEnv("APP_ENV", "development"),
+	return config, nil
+}
+
+// build assembles a Config from the source, falling back to defaults
+func (s *source) build() *Config {
+	return &Config{
+		Port:        s.getEnv("PORT", "8080"),
+		AppName:     s.getEnv("APP_NAME", "Beto Application"),
+		AppVersion:  s.getEnv("APP_VERSION", "1.0.0"),
+		Environment: s.getEnv("APP_ENV", "development"),
 
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "password"),
-			DBName:   getEnv("DB_NAME", "beto_db"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Host:     s.getEnv("DB_HOST", "localhost"),
+			Port:     s.getEnv("DB_PORT", "5432"),
+			User:     s.getEnv("DB_USER", "postgres"),
+			Password: s.getEnvFromFileOrValue("DB_PASSWORD", "password"),
+			DBName:   s.getEnv("DB_NAME", "beto_db"),
+			SSLMode:  s.getEnv("DB_SSLMODE", "disable"),
 		},
 
 		Redis: RedisConfig{
-			Host:     getEnv("REDIS_HOST", "localhost"),
-			Port:     getEnv("REDIS_PORT", "6379"),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       getEnvAsInt("REDIS_DB", 0),
+			Host:     s.getEnv("REDIS_HOST", "localhost"),
+			Port:     s.getEnv("REDIS_PORT", "6379"),
+			Password: s.getEnvFromFileOrValue("REDIS_PASSWORD", ""),
+			DB:       s.getEnvAsIntStrict("REDIS_DB", 0),
 		},
 
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "default-secret-change-me"),
-			Expiry: getEnvAsDuration("JWT_EXPIRY", "24h"),
+			Secret: s.getEnvFromFileOrValue("JWT_SECRET", defaultJWTSecret),
+			Expiry: s.getEnvAsDurationStrict("JWT_EXPIRY", "24h"),
 		},
 
 		Server: ServerConfig{
-			ReadTimeout:     getEnvAsDuration("READ_TIMEOUT", "15s"),
-			WriteTimeout:    getEnvAsDuration("WRITE_TIMEOUT", "15s"),
-			IdleTimeout:     getEnvAsDuration("IDLE_TIMEOUT", "60s"),
-			GracefulTimeout: getEnvAsDuration("GRACEFUL_TIMEOUT", "30s"),
+			ReadTimeout:     s.getEnvAsDurationStrict("READ_TIMEOUT", "15s"),
+			WriteTimeout:    s.getEnvAsDurationStrict("WRITE_TIMEOUT", "15s"),
+			IdleTimeout:     s.getEnvAsDurationStrict("IDLE_TIMEOUT", "60s"),
+			GracefulTimeout: s.getEnvAsDurationStrict("GRACEFUL_TIMEOUT", "30s"),
+			HandlerTimeout:  s.getEnvAsDurationStrict("HANDLER_TIMEOUT", "0s"),
+
+			ReadHeaderTimeout: s.getEnvAsDurationStrict("READ_HEADER_TIMEOUT", "5s"),
+
+			PreShutdownDelay:     s.getEnvAsDurationStrict("PRE_SHUTDOWN_DELAY", "0s"),
+			SlowRequestThreshold: s.getEnvAsDurationStrict("SLOW_REQUEST_THRESHOLD", "0s"),
+			LogExcludePaths:      s.getEnvAsSlice("LOG_EXCLUDE_PATHS", nil),
+
+			RequireUserAgent: s.getEnvAsBoolStrict("REQUIRE_USER_AGENT", false),
+
+			AdminToken: s.getEnv("ADMIN_TOKEN", ""),
+
+			TLSCertFile: s.getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:  s.getEnv("TLS_KEY_FILE", ""),
+
+			H2CEnabled: s.getEnvAsBoolStrict("H2C_ENABLED", false),
+			UnixSocket: s.getEnv("UNIX_SOCKET", ""),
+
+			TrustedProxies: s.getEnvAsSlice("TRUSTED_PROXIES", nil),
+
+			AllowProfilingInProduction: s.getEnvAsBoolStrict("PROFILING_ALLOW_PRODUCTION", false),
+
+			WebSocketEnabled: s.getEnvAsBoolStrict("WEBSOCKET_ENABLED", false),
+
+			TrailingSlash: s.getEnv("TRAILING_SLASH", "strict"),
 		},
 
 		CORS: CORSConfig{
-			AllowedOrigins: getEnvAsSlice("CORS_ALLOWED_ORIGINS", []string{"*"}),
-			AllowedMethods: getEnvAsSlice("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-			AllowedHeaders: getEnvAsSlice("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization"}),
+			AllowedOrigins: s.getEnvAsSlice("CORS_ALLOWED_ORIGINS", []string{"*"}),
+			AllowedMethods: s.getEnvAsSlice("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+			AllowedHeaders: s.getEnvAsSlice("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization"}),
+
+			AllowCredentials: s.getEnvAsBoolStrict("CORS_ALLOW_CREDENTIALS", false),
+			AllowWildcard:    s.getEnvAsBoolStrict("CORS_ALLOW_WILDCARD", false),
+
+			MaxAge:         s.getEnvAsDurationStrict("CORS_MAX_AGE", "0s"),
+			ExposedHeaders: s.getEnvAsSlice("CORS_EXPOSED_HEADERS", nil),
+		},
+
+		Security: SecurityConfig{
+			ContentTypeNosniff: s.getEnvAsBoolStrict("SECURITY_NOSNIFF", true),
+			FrameOptions:       s.getEnv("SECURITY_FRAME_OPTIONS", "DENY"),
+			ReferrerPolicy:     s.getEnv("SECURITY_REFERRER_POLICY", "strict-origin-when-cross-origin"),
+
+			HSTSMaxAge:            s.getEnvAsDurationStrict("SECURITY_HSTS_MAX_AGE", "8760h"),
+			HSTSIncludeSubdomains: s.getEnvAsBoolStrict("SECURITY_HSTS_INCLUDE_SUBDOMAINS", false),
 		},
 
 		RateLimit: RateLimitConfig{
-			RequestsPerWindow: getEnvAsInt("RATE_LIMIT_REQUESTS", 100),
-			WindowDuration:    getEnvAsDuration("RATE_LIMIT_WINDOW", "1m"),
+			Enabled:           s.getEnvAsBoolStrict("RATE_LIMIT_ENABLED", false),
+			RequestsPerWindow: s.getEnvAsIntStrict("RATE_LIMIT_REQUESTS", 100),
+			WindowDuration:    s.getEnvAsDurationStrict("RATE_LIMIT_WINDOW", "1m"),
+
+			ClientErrorThreshold: s.getEnvAsIntStrict("CLIENT_ERROR_THRESHOLD", 0),
+			ClientErrorWindow:    s.getEnvAsDurationStrict("CLIENT_ERROR_WINDOW", "1m"),
 		},
 
 		Logging: LoggingConfig{
-			Level:  getEnv("LOG_LEVEL", "info"),
-			Format: getEnv("LOG_FORMAT", "json"),
+			Level:  s.getEnv("LOG_LEVEL", "info"),
+			Format: s.getEnv("LOG_FORMAT", "json"),
+
+			RequestBody:         s.getEnvAsBoolStrict("LOG_REQUEST_BODY", false),
+			RequestBodyMaxBytes: s.getEnvAsIntStrict("LOG_REQUEST_BODY_MAX_BYTES", 4096),
+			RedactFields:        s.getEnvAsSlice("LOG_REDACT_FIELDS", []string{"password", "token", "secret"}),
+			AccessFormat:        s.getEnv("LOG_ACCESS_FORMAT", "json"),
+		},
+
+		Metrics: MetricsConfig{
+			Enabled: s.getEnvAsBoolStrict("METRICS_ENABLED", false),
 		},
 
 		ExternalAPIs: ExternalAPIConfig{
-			APIKey:             getEnv("API_KEY", ""),
-			ExternalServiceURL: getEnv("EXTERNAL_SERVICE_URL", "https://api.example.com"),
+			APIKey:             s.getEnvFromFileOrValue("API_KEY", ""),
+			ExternalServiceURL: s.getEnv("EXTERNAL_SERVICE_URL", "https://api.example.com"),
 		},
 
 		FileUpload: FileUploadConfig{
-			MaxFileSize: getEnv("MAX_FILE_SIZE", "10MB"),
-			UploadPath:  getEnv("UPLOAD_PATH", "./uploads"),
+			MaxFileSize: s.getEnv("MAX_FILE_SIZE", "10MB"),
+			UploadPath:  s.getEnv("UPLOAD_PATH", "./uploads"),
 		},
 	}
+}
 
-	return config, nil
+// defaultJWTSecret is the insecure fallback used when JWT_SECRET is not set
+const defaultJWTSecret = "default-secret-change-me"
+
+// Validate checks the configuration for invalid or insecure values.
+// Every problem found is reported in the returned error, not just the
+// first. The error is a *ValidationError listing the problems by field.
+// Validate only reads the filesystem; it never creates or writes files.
+func (c *Config) Validate() error {
+	var errs ValidationError
+
+	if c.JWT.Secret == "" {
+		errs.add("JWT_SECRET", "JWT_SECRET must not be empty")
+	} else if c.IsProduction() && c.JWT.Secret == defaultJWTSecret {
+		errs.add("JWT_SECRET", "JWT_SECRET must be changed from the default in production")
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 0 || port > 65535 {
+		errs.add("PORT", "PORT %q is not a valid port number", c.Port)
+	}
+
+	timeouts := map[string]time.Duration{
+		"READ_TIMEOUT":     c.Server.ReadTimeout,
+		"WRITE_TIMEOUT":    c.Server.WriteTimeout,
+		"IDLE_TIMEOUT":     c.Server.IdleTimeout,
+		"GRACEFUL_TIMEOUT": c.Server.GracefulTimeout,
+	}
+	for _, key := range []string{"READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "GRACEFUL_TIMEOUT"} {
+		if timeouts[key] <= 0 {
+			errs.add(key, "%s must be positive, got %s", key, timeouts[key])
+		}
+	}
+
+	if c.Server.ReadHeaderTimeout < 0 {
+		errs.add("READ_HEADER_TIMEOUT", "READ_HEADER_TIMEOUT must not be negative, got %s", c.Server.ReadHeaderTimeout)
+	}
+	if c.Server.HandlerTimeout < 0 {
+		errs.add("HANDLER_TIMEOUT", "HANDLER_TIMEOUT must not be negative, got %s", c.Server.HandlerTimeout)
+	}
+	if c.Server.PreShutdownDelay < 0 {
+		errs.add("PRE_SHUTDOWN_DELAY", "PRE_SHUTDOWN_DELAY must not be negative, got %s", c.Server.PreShutdownDelay)
+	}
+	if c.Server.SlowRequestThreshold < 0 {
+		errs.add("SLOW_REQUEST_THRESHOLD", "SLOW_REQUEST_THRESHOLD must not be negative, got %s", c.Server.SlowRequestThreshold)
+	}
+
+	if _, err := logger.ParseLevelStrict(c.Logging.Level); err != nil {
+		errs.add("LOG_LEVEL", "LOG_LEVEL: %w", err)
+	}
+
+	if _, err := logger.ParseFormatStrict(c.Logging.Format); err != nil {
+		errs.add("LOG_FORMAT", "LOG_FORMAT: %w", err)
+	}
+
+	if c.RateLimit.Enabled && (c.RateLimit.RequestsPerWindow <= 0 || c.RateLimit.WindowDuration <= 0) {
+		errs.add("RATE_LIMIT_REQUESTS", "RATE_LIMIT_REQUESTS and RATE_LIMIT_WINDOW must be positive when rate limiting is enabled")
+	}
+
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		errs.add("TRUSTED_PROXIES", "TRUSTED_PROXIES: %w", err)
+	}
+
+	switch c.Server.TrailingSlash {
+	case "", "strict", "redirect", "ignore":
+	default:
+		errs.add("TRAILING_SLASH", "TRAILING_SLASH %q is not one of strict, redirect or ignore", c.Server.TrailingSlash)
+	}
+
+	switch c.Logging.AccessFormat {
+	case "", "json", "common", "combined":
+	default:
+		errs.add("LOG_ACCESS_FORMAT", "LOG_ACCESS_FORMAT %q is not one of json, common or combined", c.Logging.AccessFormat)
+	}
+
+	if c.Logging.RequestBody && c.Logging.RequestBodyMaxBytes <= 0 {
+		errs.add("LOG_REQUEST_BODY_MAX_BYTES", "LOG_REQUEST_BODY_MAX_BYTES must be positive when LOG_REQUEST_BODY is enabled")
+	}
+
+	if c.RateLimit.ClientErrorThreshold < 0 {
+		errs.add("CLIENT_ERROR_THRESHOLD", "CLIENT_ERROR_THRESHOLD must not be negative")
+	}
+	if c.RateLimit.ClientErrorThreshold > 0 && c.RateLimit.ClientErrorWindow <= 0 {
+		errs.add("CLIENT_ERROR_WINDOW", "CLIENT_ERROR_WINDOW must be positive when CLIENT_ERROR_THRESHOLD is set")
+	}
+
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs.add("TLS_CERT_FILE", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if c.IsProduction() && c.CORS.AllowsAllOrigins() && !c.CORS.AllowWildcard {
+		errs.add("CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_ORIGINS must list explicit origins in production; set CORS_ALLOW_WILDCARD=true to allow \"*\"")
+	}
+
+	if c.CORS.MaxAge < 0 {
+		errs.add("CORS_MAX_AGE", "CORS_MAX_AGE must not be negative, got %s", c.CORS.MaxAge)
+	}
+
+	switch strings.ToUpper(c.Security.FrameOptions) {
+	case "", "DENY", "SAMEORIGIN":
+	default:
+		errs.add("SECURITY_FRAME_OPTIONS", "SECURITY_FRAME_OPTIONS must be DENY, SAMEORIGIN or empty, got %q", c.Security.FrameOptions)
+	}
+	if c.Security.HSTSMaxAge < 0 {
+		errs.add("SECURITY_HSTS_MAX_AGE", "SECURITY_HSTS_MAX_AGE must not be negative, got %s", c.Security.HSTSMaxAge)
+	}
+
+	if c.CORS.AllowCredentials && c.CORS.AllowsAllOrigins() {
+		errs.add("CORS_ALLOW_CREDENTIALS", "CORS_ALLOW_CREDENTIALS cannot be combined with a wildcard CORS_ALLOWED_ORIGINS")
+	}
+
+	if _, err := c.FileUpload.MaxBytes(); err != nil {
+		errs.add("MAX_FILE_SIZE", "MAX_FILE_SIZE %q is not a valid size: %w", c.FileUpload.MaxFileSize, err)
+	}
+
+	if err := checkUploadDir(c.FileUpload.UploadPath); err != nil {
+		errs.add("UPLOAD_PATH", "UPLOAD_PATH %q is not usable: %w", c.FileUpload.UploadPath, err)
+	}
+
+	return errs.err()
 }
 
 // DatabaseURL returns the database connection string
@@ -194,6 +585,83 @@ func (r RedisConfig) RedisURL() string {
 	return fmt.Sprintf("redis://%s:%s/%d", r.Host, r.Port, r.DB)
 }
 
+// TLSEnabled reports whether the server should serve HTTPS
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. A single IP becomes a prefix
+// covering just that address.
+func (s ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(s.TrustedProxies))
+	for _, proxy := range s.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid CIDR", proxy)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid IP address", proxy)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// AllowsAllOrigins reports whether the wildcard origin "*" is allowed
+func (c CORSConfig) AllowsAllOrigins() bool {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin reports whether origin may make cross-origin requests
+func (c CORSConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxBytes returns MaxFileSize in bytes. Sizes are a number with an
+// optional B, KB, MB or GB suffix, using multiples of 1024.
+func (f FileUploadConfig) MaxBytes() (int64, error) {
+	size := strings.ToUpper(strings.TrimSpace(f.MaxFileSize))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(size, unit.suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("expected a positive size such as \"10MB\", got %q", f.MaxFileSize)
+	}
+	return value * multiplier, nil
+}
+
 // IsProduction returns true if running in production environment
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
@@ -209,16 +677,170 @@ func (c *Config) IsTest() bool {
 	return c.Environment == "test"
 }
 
-// Helper functions
-func getEnv(key, defaultValue string) string {
+// source resolves configuration keys, preferring the environment over
+// values read from a config file
+type source struct {
+	file      map[string]string
+	ignoreEnv bool
+
+	// prefix is tried before each unprefixed key
+	prefix string
+
+	// errs collects values rejected by the strict helpers
+	errs []error
+}
+
+// lookup returns the value for key with variable references expanded, or
+// an empty string if it is not set
+func (s *source) lookup(key string) string {
+	if s.prefix != "" {
+		if value := s.lookupKey(s.prefix + key); value != "" {
+			return s.expand(key, s.prefix+key, value)
+		}
+	}
+	return s.expand(key, key, s.lookupKey(key))
+}
+
+// expand replaces ${VAR} references in the value read for key from name
+// with the value of VAR from the environment, or from the config file when
+// the environment is ignored. "$$" stands for a literal "$"; any other "$"
+// is kept as is. Unset variables expand to an empty string and are logged
+// as a warning. Values of secret keys are returned unchanged, as a "$" in a
+// password is far more likely than a reference.
+func (s *source) expand(key, name, value string) string {
+	if !strings.Contains(value, "$") || secretKeys[key] {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		switch next := value[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 || !validVarName(value[i+2:i+2+end]) {
+				b.WriteByte('$')
+				continue
+			}
+			ref := value[i+2 : i+2+end]
+			if resolved, ok := s.lookupVar(ref); ok {
+				b.WriteString(resolved)
+			} else {
+				logger.Warn("Config %s references unset variable %s", name, ref)
+			}
+			i += end + 2
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String()
+}
+
+// validVarName reports whether name can be referenced as ${name}
+func validVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (i > 0 && r >= '0' && r <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// lookupVar returns the value of a variable referenced from another value
+func (s *source) lookupVar(name string) (string, bool) {
+	if !s.ignoreEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+	}
+	value, ok := s.file[name]
+	return value, ok
+}
+
+// name returns the key that lookup reads the value of key from, for use in
+// error messages
+func (s *source) name(key string) string {
+	if s.prefix != "" && s.lookupKey(s.prefix+key) != "" {
+		return s.prefix + key
+	}
+	return key
+}
+
+// lookupKey returns the value for exactly key from the environment or file
+func (s *source) lookupKey(key string) string {
+	if s.ignoreEnv {
+		return s.file[key]
+	}
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	return s.file[key]
+}
+
+// Helper functions
+
+// checkUploadDir checks, without modifying anything, that path is set and,
+// if it exists, is a directory with write permission. A missing directory
+// is accepted; the --check-config self-check creates it and verifies that
+// files can be written there.
+func checkUploadDir(path string) error {
+	if path == "" {
+		return errors.New("path is empty")
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	if info.Mode().Perm()&0o222 == 0 {
+		return errors.New("directory is read-only")
+	}
+	return nil
+}
+
+func (s *source) getEnv(key, defaultValue string) string {
+	if value := s.lookup(key); value != "" {
+		return value
+	}
 	return defaultValue
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+// getEnvFromFileOrValue reads a secret from the file named by <key>_FILE,
+// such as a Docker or Kubernetes secret mount, with surrounding whitespace
+// trimmed. Without <key>_FILE it behaves like getEnv. A file that is
+// configured but cannot be read is recorded as an error.
+func (s *source) getEnvFromFileOrValue(key, defaultValue string) string {
+	fileKey := key + "_FILE"
+	path := s.lookup(fileKey)
+	if path == "" {
+		return s.getEnv(key, defaultValue)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s=%q: reading secret file: %w", s.name(fileKey), path, err))
+		return defaultValue
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (s *source) getEnvAsInt(key string, defaultValue int) int {
+	if value := s.lookup(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -226,8 +848,8 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func getEnvAsDuration(key string, defaultValue string) time.Duration {
-	if value := os.Getenv(key); value != "" {
+func (s *source) getEnvAsDuration(key string, defaultValue string) time.Duration {
+	if value := s.lookup(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
@@ -236,62 +858,66 @@ func getEnvAsDuration(key string, defaultValue string) time.Duration {
 	return duration
 }
 
-func getEnvAsSlice(key string, defaultValue []string) []string {
-	if value := os.Getenv(key); value != "" {
-		// Split by comma and trim spaces
-		var result []string
-		for _, item := range splitAndTrim(value, ",") {
-			if item != "" {
-				result = append(result, item)
-			}
-		}
-		if len(result) > 0 {
-			return result
-		}
+// getEnvAsIntStrict is like getEnvAsInt but records a malformed value as an
+// error instead of silently using the default
+func (s *source) getEnvAsIntStrict(key string, defaultValue int) int {
+	value := s.lookup(key)
+	if value == "" {
+		return defaultValue
 	}
-	return defaultValue
-}
 
-func splitAndTrim(s, sep string) []string {
-	var result []string
-	for _, item := range splitString(s, sep) {
-		trimmed := trimSpace(item)
-		result = append(result, trimmed)
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s=%q: expected an integer", s.name(key), value))
+		return defaultValue
 	}
-	return result
+	return intValue
 }
 
-func splitString(s, sep string) []string {
-	if s == "" {
-		return []string{}
+// getEnvAsDurationStrict is like getEnvAsDuration but records a malformed
+// value as an error instead of silently using the default
+func (s *source) getEnvAsDurationStrict(key string, defaultValue string) time.Duration {
+	value := s.lookup(key)
+	if value == "" {
+		value = defaultValue
 	}
 
-	var result []string
-	start := 0
-	for i := 0; i < len(s); i++ {
-		if i+len(sep) <= len(s) && s[i:i+len(sep)] == sep {
-			result = append(result, s[start:i])
-			start = i + len(sep)
-			i += len(sep) - 1
-		}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s=%q: expected a duration with a unit, such as \"15s\" or \"1m30s\"", s.name(key), value))
+		duration, _ = time.ParseDuration(defaultValue)
 	}
-	result = append(result, s[start:])
-	return result
+	return duration
 }
 
-func trimSpace(s string) string {
-	start := 0
-	end := len(s)
-
-	// Trim leading spaces
-	for start < end && (s[start] == ' ' || s[start] == '\t' || s[start] == '\n' || s[start] == '\r') {
-		start++
+// getEnvAsBoolStrict parses a boolean such as "true" or "0", recording a
+// malformed value as an error
+func (s *source) getEnvAsBoolStrict(key string, defaultValue bool) bool {
+	value := s.lookup(key)
+	if value == "" {
+		return defaultValue
 	}
 
-	// Trim trailing spaces
-	for end > start && (s[end-1] == ' ' || s[end-1] == '\t' || s[end-1] == '\n' || s[end-1] == '\r') {
-		end--
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s=%q: expected a boolean such as \"true\" or \"false\"", s.name(key), value))
+		return defaultValue
 	}
+	return boolValue
+}
 
-	return s[start:end]
+func (s *source) getEnvAsSlice(key string, defaultValue []string) []string {
+	if value := s.lookup(key); value != "" {
+		// Split by comma, trim spaces and drop empty elements
+		var result []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+		if len(result) > 0 {
+			return result
+		}
+	}
+	return defaultValue
 }
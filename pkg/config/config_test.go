@@ -0,0 +1,657 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+
+	return &Config{
+		Port:        "8080",
+		Environment: "development",
+		JWT:         JWTConfig{Secret: "test-secret", Expiry: time.Hour},
+		Server: ServerConfig{
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			GracefulTimeout: 30 * time.Second,
+		},
+		Logging:    LoggingConfig{Level: "info", Format: "json"},
+		FileUpload: FileUploadConfig{MaxFileSize: "10MB", UploadPath: t.TempDir()},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := validConfig(t)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateRejectsDefaultSecretInProduction(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.JWT.Secret = defaultJWTSecret
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Environment = "production"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "JWT_SECRET")
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.JWT.Secret = ""
+	cfg.Port = "http"
+	cfg.Server.ReadTimeout = 0
+	cfg.Logging.Level = "loud"
+	cfg.Logging.Format = "xml"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+
+	for _, key := range []string{"JWT_SECRET", "PORT", "READ_TIMEOUT", "LOG_LEVEL", "LOG_FORMAT"} {
+		assert.Contains(t, err.Error(), key)
+	}
+	assert.ErrorIs(t, err, logger.ErrInvalidLevel)
+	assert.ErrorIs(t, err, logger.ErrInvalidFormat)
+	assert.Contains(t, err.Error(), `LOG_LEVEL: invalid log level "loud", valid levels are trace, debug`)
+}
+
+func TestValidationErrorFields(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Port = "http"
+	cfg.Server.ReadTimeout = 0
+	cfg.Server.WriteTimeout = -time.Second
+	cfg.Logging.Level = "loud"
+
+	err := cfg.Validate()
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	var fields []string
+	for _, fieldErr := range validationErr.Errors() {
+		fields = append(fields, fieldErr.Field)
+		assert.Contains(t, err.Error(), fieldErr.Message)
+	}
+	assert.Equal(t, []string{"PORT", "READ_TIMEOUT", "WRITE_TIMEOUT", "LOG_LEVEL"}, fields)
+
+	fieldErrs := validationErr.Errors()
+	assert.Equal(t, `PORT "http" is not a valid port number`, fieldErrs[0].Message)
+	assert.NoError(t, fieldErrs[0].Err)
+	assert.ErrorIs(t, fieldErrs[3], logger.ErrInvalidLevel, "wrapped causes are kept")
+
+	// Errors returns a copy
+	fieldErrs[0].Field = "changed"
+	assert.Equal(t, "PORT", validationErr.Errors()[0].Field)
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("PORT", "9090")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "9090", cfg.Port)
+
+	t.Setenv("PORT", "not-a-port")
+	_, err = Load()
+	assert.Error(t, err)
+}
+
+func TestLoadSecretsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	secret := func(name, value string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(value), 0o600))
+		return path
+	}
+
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("JWT_SECRET", "from-env")
+	t.Setenv("JWT_SECRET_FILE", secret("jwt", "from-file\n"))
+	t.Setenv("DB_PASSWORD_FILE", secret("db", "  db-secret  "))
+	t.Setenv("REDIS_PASSWORD_FILE", secret("redis", "redis-secret"))
+	t.Setenv("API_KEY", "api-from-env")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.JWT.Secret, "the file takes precedence and is trimmed")
+	assert.Equal(t, "db-secret", cfg.Database.Password)
+	assert.Equal(t, "redis-secret", cfg.Redis.Password)
+	assert.Equal(t, "api-from-env", cfg.ExternalAPIs.APIKey, "without _FILE the variable is used")
+}
+
+func TestLoadSecretFileUnreadable(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("JWT_SECRET_FILE", missing)
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `JWT_SECRET_FILE="`+missing+`": reading secret file`)
+}
+
+func TestLoadFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `
+PORT: 9000
+APP_ENV: test
+DB_HOST: db.internal
+READ_TIMEOUT: 5s
+CORS_ALLOWED_ORIGINS:
+  - https://a.example.com
+  - https://b.example.com
+UPLOAD_PATH: ` + dir + `
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	t.Setenv("DB_HOST", "db.from-env")
+
+	cfg, err := LoadFromFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "9000", cfg.Port)
+	assert.Equal(t, "test", cfg.Environment)
+	assert.Equal(t, "db.from-env", cfg.Database.Host, "environment should override the file")
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORS.AllowedOrigins)
+	assert.Equal(t, "5432", cfg.Database.Port, "unset keys should fall back to defaults")
+}
+
+func TestLoadFromFileJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	content := `{"PORT": "9001", "LOG_LEVEL": "debug", "UPLOAD_PATH": "` + dir + `"}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	cfg, err := LoadFromFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "9001", cfg.Port)
+	assert.Equal(t, "debug", cfg.Logging.Level)
+}
+
+func TestLoadFromFileMissing(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+
+	cfg, err := LoadFromFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", cfg.Database.Host)
+}
+
+func TestLoadFromFileMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("PORT: [8080"), 0o600))
+
+	_, err := LoadFromFile(path)
+	assert.Error(t, err)
+}
+
+func TestLoadReportsMalformedValues(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("READ_TIMEOUT", "15")
+	t.Setenv("REDIS_DB", "zero")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `READ_TIMEOUT="15"`)
+	assert.Contains(t, err.Error(), "expected a duration")
+	assert.Contains(t, err.Error(), `REDIS_DB="zero"`)
+	assert.Contains(t, err.Error(), "expected an integer")
+}
+
+func TestLenientHelpers(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "15")
+	t.Setenv("REDIS_DB", "zero")
+
+	s := &source{}
+	assert.Equal(t, 30*time.Second, s.getEnvAsDuration("READ_TIMEOUT", "30s"))
+	assert.Equal(t, 3, s.getEnvAsInt("REDIS_DB", 3))
+	assert.Empty(t, s.errs)
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Database.Password = "db-password"
+	cfg.Redis.Password = ""
+	cfg.ExternalAPIs.APIKey = "api-key"
+	cfg.CORS.AllowedOrigins = []string{"https://example.com"}
+
+	redacted := cfg.Redacted()
+
+	assert.Equal(t, "***", redacted.JWT.Secret)
+	assert.Equal(t, "***", redacted.Database.Password)
+	assert.Equal(t, "", redacted.Redis.Password)
+	assert.Equal(t, "***", redacted.ExternalAPIs.APIKey)
+
+	// The original must be untouched, including shared slices
+	redacted.CORS.AllowedOrigins[0] = "changed"
+	assert.Equal(t, "test-secret", cfg.JWT.Secret)
+	assert.Equal(t, "https://example.com", cfg.CORS.AllowedOrigins[0])
+}
+
+func TestDump(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Database.Password = "db-password"
+
+	var buf bytes.Buffer
+	require.NoError(t, cfg.Dump(&buf))
+
+	var dumped map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &dumped))
+	assert.NotContains(t, buf.String(), "db-password")
+	assert.NotContains(t, buf.String(), "test-secret")
+	assert.Equal(t, "8080", dumped["Port"])
+}
+
+func TestGetEnvAsSlice(t *testing.T) {
+	defaults := []string{"default"}
+
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{name: "Unset", value: "", expected: defaults},
+		{name: "Single value", value: "a", expected: []string{"a"}},
+		{name: "Spaces around values", value: " a , b ", expected: []string{"a", "b"}},
+		{name: "Empty element", value: "a,,b", expected: []string{"a", "b"}},
+		{name: "Trailing comma", value: "a,b,", expected: []string{"a", "b"}},
+		{name: "Whitespace-only element", value: " , a , ", expected: []string{"a"}},
+		{name: "Only separators", value: " , , ", expected: defaults},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_SLICE", tt.value)
+
+			s := &source{}
+			assert.Equal(t, tt.expected, s.getEnvAsSlice("TEST_SLICE", defaults))
+		})
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	t.Setenv("TEST_REGION", "eu-west-1")
+	t.Setenv("TEST_INNER", "${TEST_REGION}")
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{name: "Braced", value: "https://${TEST_REGION}.api.example.com", expected: "https://eu-west-1.api.example.com"},
+		{name: "Bare is not a reference", value: "$TEST_REGION-backup", expected: "$TEST_REGION-backup"},
+		{name: "Repeated", value: "${TEST_REGION}/${TEST_REGION}", expected: "eu-west-1/eu-west-1"},
+		{name: "Lone dollar", value: "costs 5$", expected: "costs 5$"},
+		{name: "Unterminated", value: "${TEST_REGION", expected: "${TEST_REGION"},
+		{name: "Not expanded twice", value: "${TEST_INNER}", expected: "${TEST_REGION}"},
+		{name: "Escaped dollar", value: "pa$$word", expected: "pa$word"},
+		{name: "Escaped reference", value: "$${TEST_REGION}", expected: "${TEST_REGION}"},
+		{name: "Missing", value: "https://${TEST_UNSET_REGION}.api.example.com", expected: "https://.api.example.com"},
+		{name: "No references", value: "plain", expected: "plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_EXPAND", tt.value)
+
+			s := &source{}
+			assert.Equal(t, tt.expected, s.getEnv("TEST_EXPAND", ""))
+		})
+	}
+}
+
+func TestExpandSkipsSecrets(t *testing.T) {
+	t.Setenv("TEST_REGION", "eu-west-1")
+	t.Setenv("DB_PASSWORD", "pa$$w${TEST_REGION}$x")
+
+	s := &source{}
+	assert.Equal(t, "pa$$w${TEST_REGION}$x", s.getEnvFromFileOrValue("DB_PASSWORD", ""))
+}
+
+func TestExpandMissingVariableWarns(t *testing.T) {
+	var buf bytes.Buffer
+	previous := logger.GetGlobalLogger()
+	logger.SetGlobalLogger(logger.New(logger.Config{Level: "warn", Format: "json", Output: &buf}))
+	t.Cleanup(func() { logger.SetGlobalLogger(previous) })
+
+	t.Setenv("TEST_EXPAND", "${TEST_UNSET_REGION}")
+	s := &source{}
+	assert.Equal(t, "default", s.getEnv("TEST_EXPAND", "default"), "a value that expands to nothing is unset")
+
+	assert.Contains(t, buf.String(), "Config TEST_EXPAND references unset variable TEST_UNSET_REGION")
+}
+
+func TestExpandFromConfigFile(t *testing.T) {
+	s := &source{ignoreEnv: true, file: map[string]string{
+		"REGION":               "us-east-1",
+		"EXTERNAL_SERVICE_URL": "https://${REGION}.api.example.com",
+	}}
+	assert.Equal(t, "https://us-east-1.api.example.com", s.getEnv("EXTERNAL_SERVICE_URL", ""))
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content+"\nUPLOAD_PATH: "+dir+"\n"), 0o600))
+	}
+	write("LOG_LEVEL: info")
+
+	changes := make(chan *Config, 16)
+	watcher, err := Watch(path, func(cfg *Config) { changes <- cfg })
+	require.NoError(t, err)
+	defer watcher.Stop()
+
+	write("LOG_LEVEL: debug")
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case cfg := <-changes:
+			if cfg.Logging.Level == "debug" {
+				require.NoError(t, watcher.Stop())
+				require.NoError(t, watcher.Stop(), "Stop should be idempotent")
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for config reload")
+		}
+	}
+}
+
+func TestWatchIgnoresInvalidReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("LOG_LEVEL: loud\nUPLOAD_PATH: "+dir+"\n"), 0o600))
+
+	called := false
+	w := &Watcher{path: path, onChange: func(*Config) { called = true }}
+	w.reload()
+
+	assert.False(t, called, "invalid configuration must not reach the callback")
+}
+
+func TestMaxBytes(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+		wantErr  bool
+	}{
+		{size: "512", expected: 512},
+		{size: "512B", expected: 512},
+		{size: "10KB", expected: 10 << 10},
+		{size: "10MB", expected: 10 << 20},
+		{size: "1 gb", expected: 1 << 30},
+		{size: "ten", wantErr: true},
+		{size: "0MB", wantErr: true},
+		{size: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			size, err := FileUploadConfig{MaxFileSize: tt.size}.MaxBytes()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, size)
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	t.Setenv("PORT", "9999")
+
+	cfg := Default()
+	assert.Equal(t, "8080", cfg.Port, "Default must ignore the environment")
+	assert.Equal(t, "10MB", cfg.FileUpload.MaxFileSize)
+}
+
+func TestValidateRejectsCredentialsWithWildcard(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.CORS = CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CORS_ALLOW_CREDENTIALS")
+
+	cfg.CORS.AllowedOrigins = []string{"https://app.example.com"}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateTrailingSlash(t *testing.T) {
+	cfg := validConfig(t)
+	for _, mode := range []string{"strict", "redirect", "ignore"} {
+		cfg.Server.TrailingSlash = mode
+		assert.NoError(t, cfg.Validate())
+	}
+
+	cfg.Server.TrailingSlash = "sometimes"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TRAILING_SLASH")
+}
+
+func TestValidateRequiresTLSPair(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Server.TLSCertFile = "cert.pem"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS_KEY_FILE")
+
+	cfg.Server.TLSKeyFile = "key.pem"
+	assert.NoError(t, cfg.Validate())
+	assert.True(t, cfg.Server.TLSEnabled())
+}
+
+func TestValidateCORSWildcardByEnvironment(t *testing.T) {
+	tests := []struct {
+		environment   string
+		allowWildcard bool
+		wantErr       bool
+	}{
+		{environment: "development"},
+		{environment: "test"},
+		{environment: "production", wantErr: true},
+		{environment: "production", allowWildcard: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/allow=%t", tt.environment, tt.allowWildcard), func(t *testing.T) {
+			cfg := validConfig(t)
+			cfg.Environment = tt.environment
+			cfg.CORS = CORSConfig{AllowedOrigins: []string{"*"}, AllowWildcard: tt.allowWildcard}
+
+			err := cfg.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "CORS_ALLOW_WILDCARD")
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	// Explicit origins are always accepted
+	cfg := validConfig(t)
+	cfg.Environment = "production"
+	cfg.CORS = CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadRejectsWildcardCORSInProduction(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("JWT_SECRET", "production-secret")
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CORS_ALLOW_WILDCARD")
+
+	t.Setenv("CORS_ALLOW_WILDCARD", "true")
+	_, err = Load()
+	assert.NoError(t, err)
+}
+
+func TestLoadWithPrefix(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("DB_HOST", "shared.internal")
+	t.Setenv("DB_NAME", "shared_db")
+	t.Setenv("TENANT1_DB_HOST", "tenant1.internal")
+	t.Setenv("TENANT2_DB_HOST", "tenant2.internal")
+	t.Setenv("TENANT2_DB_NAME", "tenant2_db")
+
+	tenant1, err := LoadWithPrefix("TENANT1_")
+	require.NoError(t, err)
+	tenant2, err := LoadWithPrefix("TENANT2_")
+	require.NoError(t, err)
+	unprefixed, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "tenant1.internal", tenant1.Database.Host)
+	assert.Equal(t, "shared_db", tenant1.Database.DBName, "unset prefixed keys fall back to the unprefixed key")
+	assert.Equal(t, "tenant2.internal", tenant2.Database.Host)
+	assert.Equal(t, "tenant2_db", tenant2.Database.DBName)
+	assert.Equal(t, "shared.internal", unprefixed.Database.Host)
+	assert.Equal(t, "5432", tenant1.Database.Port, "unset keys still use defaults")
+
+	t.Setenv("TENANT1_REDIS_DB", "one")
+	_, err = LoadWithPrefix("TENANT1_")
+	require.Error(t, err, "prefixed values are validated like any other")
+	assert.Contains(t, err.Error(), `TENANT1_REDIS_DB="one"`)
+}
+
+func TestLoadDotEnvReload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("BETO_TEST_FROM_ENV", "env")
+	t.Cleanup(func() {
+		os.Unsetenv("BETO_TEST_FROM_FILE")
+		dotEnvMu.Lock()
+		delete(dotEnvKeys, "BETO_TEST_FROM_FILE")
+		dotEnvMu.Unlock()
+	})
+
+	write := func(contents string) {
+		require.NoError(t, os.WriteFile(".env", []byte(contents), 0o600))
+	}
+
+	write("BETO_TEST_FROM_FILE=one\nBETO_TEST_FROM_ENV=file\n")
+	loadDotEnv()
+	assert.Equal(t, "one", os.Getenv("BETO_TEST_FROM_FILE"))
+	assert.Equal(t, "env", os.Getenv("BETO_TEST_FROM_ENV"), "the environment takes precedence")
+
+	write("BETO_TEST_FROM_FILE=two\nBETO_TEST_FROM_ENV=file\n")
+	loadDotEnv()
+	assert.Equal(t, "two", os.Getenv("BETO_TEST_FROM_FILE"), "edits to .env are picked up")
+	assert.Equal(t, "env", os.Getenv("BETO_TEST_FROM_ENV"))
+}
+
+func TestLoadCORSMaxAgeAndExposedHeaders(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("CORS_MAX_AGE", "10m")
+	t.Setenv("CORS_EXPOSED_HEADERS", "X-Request-ID, X-Total-Count")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.CORS.MaxAge)
+	assert.Equal(t, []string{"X-Request-ID", "X-Total-Count"}, cfg.CORS.ExposedHeaders)
+
+	t.Setenv("CORS_MAX_AGE", "-1s")
+	_, err = Load()
+	assert.ErrorContains(t, err, "CORS_MAX_AGE")
+}
+
+func TestLoadSecurityHeaders(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.Security.ContentTypeNosniff)
+	assert.Equal(t, "DENY", cfg.Security.FrameOptions)
+	assert.Equal(t, "strict-origin-when-cross-origin", cfg.Security.ReferrerPolicy)
+	assert.Equal(t, 365*24*time.Hour, cfg.Security.HSTSMaxAge)
+
+	t.Setenv("SECURITY_FRAME_OPTIONS", "ALLOW-FROM https://example.com")
+	t.Setenv("SECURITY_HSTS_MAX_AGE", "-1s")
+	_, err = Load()
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Errors(), 2)
+	assert.Equal(t, "SECURITY_FRAME_OPTIONS", validationErr.Errors()[0].Field)
+	assert.Equal(t, "SECURITY_HSTS_MAX_AGE", validationErr.Errors()[1].Field)
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"}
+	require.NoError(t, cfg.Validate())
+
+	prefixes, err := cfg.Server.TrustedProxyPrefixes()
+	require.NoError(t, err)
+	require.Len(t, prefixes, 3)
+	assert.Equal(t, "192.0.2.7/32", prefixes[1].String())
+
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/33"}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TRUSTED_PROXIES")
+
+	cfg.Server.TrustedProxies = []string{"proxy.internal"}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateUploadPathHasNoSideEffects(t *testing.T) {
+	cfg := validConfig(t)
+	dir := filepath.Join(t.TempDir(), "uploads")
+	cfg.FileUpload.UploadPath = dir
+
+	require.NoError(t, cfg.Validate(), "a missing directory is accepted")
+	_, err := os.Stat(dir)
+	assert.ErrorIs(t, err, fs.ErrNotExist, "Validate must not create the directory")
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	cfg.FileUpload.UploadPath = file
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a directory")
+
+	readOnly := t.TempDir()
+	require.NoError(t, os.Chmod(readOnly, 0o555))
+	cfg.FileUpload.UploadPath = readOnly
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read-only")
+}
+
+func TestLoadUnvalidated(t *testing.T) {
+	t.Setenv("UPLOAD_PATH", t.TempDir())
+	t.Setenv("TRAILING_SLASH", "sometimes")
+	t.Setenv("READ_TIMEOUT", "soon")
+
+	cfg, err := LoadUnvalidated()
+	require.Error(t, err)
+	require.NotNil(t, cfg, "the config is returned despite errors")
+	assert.Contains(t, err.Error(), "READ_TIMEOUT")
+	assert.Equal(t, 15*time.Second, cfg.Server.ReadTimeout, "unparsable values keep their defaults")
+
+	assert.Equal(t, "sometimes", cfg.Server.TrailingSlash, "values are not validated")
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// redactedValue replaces secret values in redacted output
+const redactedValue = "***"
+
+// secrets returns pointers to every secret-bearing field of c.
+// New secret fields must be added here so Redacted masks them, and their
+// keys to secretKeys.
+func (c *Config) secrets() []*string {
+	return []*string{
+		&c.JWT.Secret,
+		&c.Database.Password,
+		&c.Redis.Password,
+		&c.ExternalAPIs.APIKey,
+		&c.Server.AdminToken,
+	}
+}
+
+// secretKeys are the keys of the values returned by secrets, which are
+// read verbatim without ${VAR} expansion
+var secretKeys = map[string]bool{
+	"JWT_SECRET":     true,
+	"DB_PASSWORD":    true,
+	"REDIS_PASSWORD": true,
+	"API_KEY":        true,
+	"ADMIN_TOKEN":    true,
+}
+
+// Redacted returns a deep copy of the configuration with secret values
+// masked, safe for logging. Empty secrets stay empty so that unset values
+// remain visible.
+func (c *Config) Redacted() Config {
+	redacted := *c
+	redacted.CORS.AllowedOrigins = append([]string(nil), c.CORS.AllowedOrigins...)
+	redacted.CORS.AllowedMethods = append([]string(nil), c.CORS.AllowedMethods...)
+	redacted.CORS.AllowedHeaders = append([]string(nil), c.CORS.AllowedHeaders...)
+	redacted.CORS.ExposedHeaders = append([]string(nil), c.CORS.ExposedHeaders...)
+	redacted.Server.LogExcludePaths = append([]string(nil), c.Server.LogExcludePaths...)
+	redacted.Server.TrustedProxies = append([]string(nil), c.Server.TrustedProxies...)
+
+	for _, secret := range redacted.secrets() {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	return redacted
+}
+
+// Dump writes the redacted configuration to w as indented JSON
+func (c *Config) Dump(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c.Redacted())
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FieldError is a problem with one configuration field
+type FieldError struct {
+	// Field is the environment variable or config file key at fault, such
+	// as "PORT"
+	Field string
+
+	// Message describes the problem and is suitable for display
+	Message string
+
+	// Err is the underlying error, if any, for use with errors.Is and
+	// errors.As
+	Err error
+}
+
+func (e FieldError) Error() string { return e.Message }
+func (e FieldError) Unwrap() error { return e.Err }
+
+// ValidationError is returned by Validate and lists every problem found,
+// so that callers can report them per field
+type ValidationError struct {
+	errs []FieldError
+}
+
+// Errors returns the individual field errors in the order they were found
+func (e *ValidationError) Errors() []FieldError {
+	return append([]FieldError(nil), e.errs...)
+}
+
+// Error returns every message, one per line
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		messages[i] = err.Message
+	}
+	return "invalid configuration: " + strings.Join(messages, "\n")
+}
+
+// Unwrap returns the field errors so that errors.Is and errors.As see
+// their underlying errors
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.errs))
+	for i, err := range e.errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// add records a problem with field. The message is formatted as by
+// fmt.Errorf, and an error wrapped with %w becomes the underlying error.
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+	e.errs = append(e.errs, FieldError{Field: field, Message: err.Error(), Err: errors.Unwrap(err)})
+}
+
+// err returns e, or nil when no problems were recorded
+func (e *ValidationError) err() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return e
+}
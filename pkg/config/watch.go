@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// Watcher reloads a config file when it changes on disk
+type Watcher struct {
+	path     string
+	onChange func(*Config)
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Watch reloads the config file at path with LoadFromFile whenever it
+// changes and passes the new configuration to onChange. Reloads that fail
+// to parse or validate are logged and ignored, leaving the previous
+// configuration in effect.
+//
+// Only some settings can be applied to a running server. Logging.Level and
+// the RateLimit settings are safe to change live. All other settings, such
+// as the log format, the port, server timeouts, CORS, database, Redis and
+// JWT configuration, are only read at startup and require a restart.
+func Watch(path string, onChange func(*Config)) (*Watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating config watcher: %w", err)
+	}
+
+	// Watch the directory rather than the file so that editors and
+	// orchestrators that replace the file atomically are picked up
+	if err := fsWatcher.Add(filepath.Dir(path)); err != nil {
+		fsWatcher.Close()
+		return nil, fmt.Errorf("watching config file %s: %w", path, err)
+	}
+
+	w := &Watcher{
+		path:     filepath.Clean(path),
+		onChange: onChange,
+		watcher:  fsWatcher,
+		done:     make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w, nil
+}
+
+// Stop stops watching the config file. It is safe to call more than once.
+func (w *Watcher) Stop() error {
+	var err error
+	w.stopOnce.Do(func() {
+		close(w.done)
+		err = w.watcher.Close()
+		w.wg.Wait()
+	})
+	return err
+}
+
+// run processes file system events until the watcher is stopped
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != w.path || !event.Has(fsnotify.Write|fsnotify.Create) {
+				continue
+			}
+			w.reload()
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("Config watcher error: %v", err)
+		}
+	}
+}
+
+// reload loads the config file and invokes the callback if it is valid
+func (w *Watcher) reload() {
+	cfg, err := LoadFromFile(w.path)
+	if err != nil {
+		logger.Warn("Ignoring invalid config reload from %s: %v", w.path, err)
+		return
+	}
+	w.onChange(cfg)
+}
@@ -0,0 +1,158 @@
+package httpclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// Circuit breaker defaults used by New
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting the service while the
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a Breaker
+type BreakerState int
+
+const (
+	// StateClosed lets every request through
+	StateClosed BreakerState = iota
+	// StateOpen rejects every request until the cooldown has passed
+	StateOpen
+	// StateHalfOpen lets a single trial request through to decide whether
+	// to close or to open again
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is a circuit breaker. After Threshold consecutive failures it
+// opens and rejects requests with ErrCircuitOpen for Cooldown. It then
+// lets one trial request through: success closes it again, failure opens
+// it for another Cooldown. A Breaker is safe for concurrent use.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	// Logger receives a message for every state change
+	Logger *logger.Logger
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker creates a closed breaker that opens after threshold
+// consecutive failures and stays open for cooldown
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// State returns the current state. An open breaker whose cooldown has
+// passed reports StateHalfOpen.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.Cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a request may be sent, returning ErrCircuitOpen if
+// not. Every allowed request must be followed by a call to Record.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.transition(StateHalfOpen)
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a request let through by Allow
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		if b.state != StateClosed {
+			b.transition(StateClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+		b.transition(StateOpen)
+	}
+}
+
+// release ends a request let through by Allow whose outcome says nothing
+// about the service, such as one cancelled by its caller
+func (b *Breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// transition changes the state and logs the change. b.mu must be held.
+func (b *Breaker) transition(to BreakerState) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	if b.Logger == nil {
+		return
+	}
+
+	log := b.Logger.WithFields(map[string]interface{}{
+		"from":     from.String(),
+		"to":       to.String(),
+		"failures": b.failures,
+	})
+	if to == StateOpen {
+		log.WithField("cooldown", b.Cooldown.String()).Warn("Circuit breaker opened")
+		return
+	}
+	log.Info("Circuit breaker state changed")
+}
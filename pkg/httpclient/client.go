@@ -0,0 +1,195 @@
+// Package httpclient provides a client for the external service described
+// by config.ExternalAPIConfig. Requests carry the API key and are retried
+// with exponential backoff when the service fails.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// APIKeyHeader carries the API key on every request
+const APIKeyHeader = "X-API-Key"
+
+// Retry defaults used by New
+const (
+	DefaultMaxRetries = 3
+	DefaultBaseDelay  = 100 * time.Millisecond
+	DefaultMaxDelay   = 5 * time.Second
+	DefaultTimeout    = 30 * time.Second
+)
+
+// Client performs requests against an external service. Requests that fail
+// with a network error or a 5xx response are retried up to MaxRetries times,
+// waiting BaseDelay, then twice as long each time, up to MaxDelay. A
+// Retry-After header on the response overrides the computed delay. Retries
+// stop as soon as the request context is done. Every attempt passes
+// through Breaker, when set, so that a service that keeps failing is not
+// sent more requests until it has had time to recover.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	APIKey     string
+
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+
+	// Breaker counts network errors and 5xx responses. Nil disables it.
+	Breaker *Breaker
+
+	// Logger receives a warning for every retry
+	Logger *logger.Logger
+}
+
+// New creates a client for the external service in cfg with the default
+// retry policy and circuit breaker
+func New(cfg config.ExternalAPIConfig) *Client {
+	log := logger.NewDefault().Named("httpclient")
+	breaker := NewBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown)
+	breaker.Logger = log
+	return &Client{
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+		BaseURL:    strings.TrimRight(cfg.ExternalServiceURL, "/"),
+		APIKey:     cfg.APIKey,
+		MaxRetries: DefaultMaxRetries,
+		BaseDelay:  DefaultBaseDelay,
+		MaxDelay:   DefaultMaxDelay,
+		Breaker:    breaker,
+		Logger:     log,
+	}
+}
+
+// Get sends a GET request for path, relative to BaseURL
+func (c *Client) Get(ctx context.Context, path string) (*http.Response, error) {
+	return c.Do(ctx, http.MethodGet, path, nil, nil)
+}
+
+// PostJSON sends v encoded as JSON in a POST request to path, relative to
+// BaseURL
+func (c *Client) PostJSON(ctx context.Context, path string, v interface{}) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encoding request body: %w", err)
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	return c.Do(ctx, http.MethodPost, path, body, header)
+}
+
+// Do sends a request for path, relative to BaseURL, retrying it as
+// described on Client. When every attempt fails with a 5xx, the last
+// response is returned with a nil error so the caller can inspect it.
+// While the breaker is open it returns an error wrapping ErrCircuitOpen
+// without sending the request.
+func (c *Client) Do(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	url := c.BaseURL + path
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if c.APIKey != "" {
+			req.Header.Set(APIKeyHeader, c.APIKey)
+		}
+
+		if c.Breaker != nil {
+			if err := c.Breaker.Allow(); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, url, err)
+			}
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		success := err == nil && resp.StatusCode < 500
+		if c.Breaker != nil {
+			if !success && ctx.Err() != nil {
+				// A cancelled request says nothing about the service
+				c.Breaker.release()
+			} else {
+				c.Breaker.Record(success)
+			}
+		}
+		if success {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, fmt.Errorf("%s %s: %w", method, url, ctx.Err())
+		}
+		if attempt >= c.MaxRetries {
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, url, err)
+			}
+			return resp, nil
+		}
+
+		delay := c.backoff(attempt)
+		fields := map[string]interface{}{
+			"method":  method,
+			"url":     url,
+			"attempt": attempt + 1,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		} else {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = min(after, c.MaxDelay)
+			}
+			fields["status_code"] = resp.StatusCode
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		fields["delay"] = delay.String()
+		if c.Logger != nil {
+			c.Logger.WithFields(fields).Warn("Retrying external API request")
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%s %s: %w", method, url, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before retry number attempt+1
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.BaseDelay
+	for i := 0; i < attempt && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, c.MaxDelay)
+}
+
+// retryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
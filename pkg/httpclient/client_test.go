@@ -0,0 +1,266 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// newTestClient returns a client for server with short delays that logs
+// to buf
+func newTestClient(server *httptest.Server, buf *bytes.Buffer) *Client {
+	client := New(config.ExternalAPIConfig{APIKey: "test-key", ExternalServiceURL: server.URL + "/"})
+	client.BaseDelay = time.Millisecond
+	client.MaxDelay = 10 * time.Millisecond
+	client.Logger = logger.New(logger.Config{Level: "info", Format: "json", Output: buf})
+	client.Breaker.Logger = client.Logger
+	return client
+}
+
+// failingServer answers the first failures requests with a 503 and the
+// rest with handler
+func failingServer(t *testing.T, failures int32, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestGetRetriesUntilSuccess(t *testing.T) {
+	server, calls := failingServer(t, 2, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/items", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get(APIKeyHeader))
+		w.Write([]byte("ok"))
+	})
+
+	var buf bytes.Buffer
+	resp, err := newTestClient(server, &buf).Get(context.Background(), "/items")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2, "one warning per retry")
+	assert.Contains(t, lines[0], `"attempt":1`)
+	assert.Contains(t, lines[1], `"attempt":2`)
+	assert.Contains(t, lines[1], `"status_code":503`)
+}
+
+func TestPostJSONResendsBody(t *testing.T) {
+	server, calls := failingServer(t, 2, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var payload map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Equal(t, "value", payload["key"])
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	var buf bytes.Buffer
+	resp, err := newTestClient(server, &buf).PostJSON(context.Background(), "/items", map[string]string{"key": "value"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	server, calls := failingServer(t, 100, nil)
+
+	var buf bytes.Buffer
+	resp, err := newTestClient(server, &buf).Get(context.Background(), "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(DefaultMaxRetries+1), atomic.LoadInt32(calls))
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	server, calls := failingServer(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	var buf bytes.Buffer
+	resp, err := newTestClient(server, &buf).Get(context.Background(), "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.Empty(t, buf.String())
+}
+
+func TestRetryAfterHonored(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client := newTestClient(server, &buf)
+	client.MaxDelay = time.Second
+
+	start := time.Now()
+	resp, err := client.Get(context.Background(), "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Contains(t, buf.String(), `"delay":"1s"`)
+}
+
+func TestContextDeadlineStopsRetries(t *testing.T) {
+	server, _ := failingServer(t, 100, nil)
+
+	var buf bytes.Buffer
+	client := newTestClient(server, &buf)
+	client.MaxRetries = 100
+	client.BaseDelay = time.Second
+	client.MaxDelay = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.Get(ctx, "/")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestBreakerTripsAndRecovers(t *testing.T) {
+	var healthy atomic.Bool
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client := newTestClient(server, &buf)
+	client.MaxRetries = 0
+	client.Breaker.Threshold = 3
+	client.Breaker.Cooldown = 50 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(context.Background(), "/")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, StateOpen, client.Breaker.State())
+	assert.Contains(t, buf.String(), `"message":"Circuit breaker opened"`)
+
+	_, err := client.Get(context.Background(), "/")
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "an open breaker sends no request")
+
+	time.Sleep(client.Breaker.Cooldown)
+	assert.Equal(t, StateHalfOpen, client.Breaker.State())
+
+	healthy.Store(true)
+	resp, err := client.Get(context.Background(), "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, StateClosed, client.Breaker.State())
+	assert.Contains(t, buf.String(), `"to":"closed"`)
+}
+
+func TestBreakerStopsRetries(t *testing.T) {
+	server, calls := failingServer(t, 100, nil)
+
+	var buf bytes.Buffer
+	client := newTestClient(server, &buf)
+	client.Breaker.Threshold = 2
+
+	_, err := client.Get(context.Background(), "/")
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	breaker := NewBreaker(1, 20*time.Millisecond)
+
+	require.NoError(t, breaker.Allow())
+	breaker.Record(false)
+	assert.ErrorIs(t, breaker.Allow(), ErrCircuitOpen)
+
+	time.Sleep(breaker.Cooldown)
+	require.NoError(t, breaker.Allow(), "one trial request after the cooldown")
+	assert.ErrorIs(t, breaker.Allow(), ErrCircuitOpen, "only one trial at a time")
+
+	breaker.Record(false)
+	assert.Equal(t, StateOpen, breaker.State(), "a failed trial opens the breaker again")
+	assert.ErrorIs(t, breaker.Allow(), ErrCircuitOpen)
+}
+
+func TestBackoff(t *testing.T) {
+	client := &Client{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, client.backoff(0))
+	assert.Equal(t, 200*time.Millisecond, client.backoff(1))
+	assert.Equal(t, 800*time.Millisecond, client.backoff(3))
+	assert.Equal(t, time.Second, client.backoff(4))
+	assert.Equal(t, time.Second, client.backoff(60))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "Seconds", value: "120", expected: 2 * time.Minute, ok: true},
+		{name: "Date", value: now.Add(30 * time.Second).Format(http.TimeFormat), expected: 30 * time.Second, ok: true},
+		{name: "Past date", value: now.Add(-time.Minute).Format(http.TimeFormat), expected: 0, ok: true},
+		{name: "Missing", value: "", ok: false},
+		{name: "Invalid", value: "soon", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := retryAfter(tt.value, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, delay)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Access log formats for HTTPLogOptions.AccessFormat
+const (
+	// AccessFormatJSON logs each request as a structured entry
+	AccessFormatJSON = "json"
+
+	// AccessFormatCommon logs each request in the NCSA Common Log Format
+	AccessFormatCommon = "common"
+
+	// AccessFormatCombined logs each request in the Apache/Nginx Combined
+	// Log Format, which adds the referrer and user agent to Common
+	AccessFormatCombined = "combined"
+)
+
+// clfTimeFormat is the timestamp layout of the Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// formatAccessLine renders a request in the Common or Combined Log Format.
+// The host is taken from clientIP when it is set.
+func formatAccessLine(format string, r *http.Request, clientIP func(*http.Request) string, start time.Time, status int, bytesWritten int64) string {
+	var host string
+	if clientIP != nil {
+		host = clientIP(r)
+	} else {
+		var err error
+		host, _, err = net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+	}
+
+	user := "-"
+	if name, _, ok := r.BasicAuth(); ok && name != "" {
+		user = name
+	} else if r.URL.User != nil && r.URL.User.Username() != "" {
+		user = r.URL.User.Username()
+	}
+
+	size := "-"
+	if bytesWritten > 0 {
+		size = strconv.FormatInt(bytesWritten, 10)
+	}
+
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		clfField(host), clfField(user), start.Format(clfTimeFormat),
+		r.Method, clfEscape(r.URL.RequestURI()), r.Proto, status, size)
+
+	if format == AccessFormatCombined {
+		line += fmt.Sprintf(` "%s" "%s"`, clfEscape(r.Referer()), clfEscape(r.UserAgent()))
+	}
+	return line
+}
+
+// clfField returns value, or "-" if it is empty, with spaces escaped
+func clfField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(clfEscape(value), " ", "%20")
+}
+
+// clfEscape escapes characters that would break a quoted log field
+func clfEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// timestampFormat is the layout of entry timestamps and of time.Time field
+// values
+const timestampFormat = time.RFC3339
+
+// coerceFields returns fields with values that encode poorly replaced by
+// readable strings, so that every format shows them the same way: an
+// error would otherwise be {} in JSON and a time.Time would be in Go's
+// default layout in text. fields is not modified; a copy is made only when
+// a value needs replacing.
+func coerceFields(fields map[string]interface{}) map[string]interface{} {
+	var coerced map[string]interface{}
+	for k, v := range fields {
+		s, ok := coerceValue(v)
+		if !ok {
+			continue
+		}
+		if coerced == nil {
+			coerced = make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				coerced[k] = v
+			}
+		}
+		coerced[k] = s
+	}
+	if coerced == nil {
+		return fields
+	}
+	return coerced
+}
+
+// coerceValue returns the string form of an error, time.Time or
+// fmt.Stringer value and true, or false for any other value
+func coerceValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil, string:
+		return "", false
+	case time.Time:
+		return v.Format(timestampFormat), true
+	case error, fmt.Stringer:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			// Calling a method on a nil pointer would most likely panic
+			return "<nil>", true
+		}
+		if err, ok := v.(error); ok {
+			return err.Error(), true
+		}
+		return v.(fmt.Stringer).String(), true
+	default:
+		return "", false
+	}
+}
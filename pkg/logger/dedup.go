@@ -0,0 +1,198 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OccurrencesField holds the number of entries collapsed into one by
+// deduplication
+const OccurrencesField = "occurrences"
+
+// deduper collapses repeated entries. Entries with the same level, message
+// and values of the key fields are held for the window and then written as
+// a single entry, the first one seen, with an occurrences count.
+type deduper struct {
+	window   time.Duration
+	keys     []string
+	fallback io.Writer
+
+	mu      sync.Mutex
+	pending map[string]*aggregate
+	seq     uint64
+	closed  bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// aggregate is a deduplicated entry waiting for its window to close
+type aggregate struct {
+	entry    LogEntry
+	logger   *Logger
+	count    int
+	deadline time.Time
+	seq      uint64
+}
+
+// newDeduper starts a deduper that flushes closed windows in the
+// background. Panics while flushing are reported to fallback.
+func newDeduper(window time.Duration, keys []string, fallback io.Writer) *deduper {
+	d := &deduper{
+		window:   window,
+		keys:     append([]string(nil), keys...),
+		fallback: fallback,
+		pending:  make(map[string]*aggregate),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// run flushes aggregates whose window has closed until close is called. If
+// flushing panics, for example in a misbehaving output writer, the flusher
+// is restarted so that deduplicated entries keep being written.
+func (d *deduper) run() {
+	defer close(d.done)
+
+	for !d.drain() {
+	}
+}
+
+// drain flushes aggregates whose window has closed. It returns true when
+// close is called, and false after recovering from a panic, which is
+// reported to the fallback writer. The aggregates being flushed when the
+// panic happened are lost.
+func (d *deduper) drain() (stopped bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			d.reportPanic(err)
+		}
+	}()
+
+	// Windows close at most a quarter of a window late
+	ticker := time.NewTicker(max(d.window/4, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return true
+		case now := <-ticker.C:
+			d.flush(func(a *aggregate) bool { return !now.Before(a.deadline) })
+		}
+	}
+}
+
+// reportPanic writes a JSON entry describing a recovered panic to the
+// fallback writer. Like Logger.write it never logs through a logger, as
+// the output may be what panicked.
+func (d *deduper) reportPanic(err interface{}) {
+	if d.fallback == nil {
+		return
+	}
+
+	line, _ := json.Marshal(LogEntry{
+		Timestamp: time.Now().UTC().Format(timestampFormat),
+		Level:     ERROR.String(),
+		Message:   "Recovered from panic in log deduplication flusher",
+		Fields: map[string]interface{}{
+			"panic": fmt.Sprint(err),
+			"stack": string(debug.Stack()),
+		},
+	})
+	d.fallback.Write(append(line, '\n'))
+}
+
+// add records entry, logged by l, in the aggregate for its key. It returns
+// false once the deduper is closed, and the caller must write the entry.
+func (d *deduper) add(l *Logger, entry LogEntry) bool {
+	key := d.key(entry)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return false
+	}
+	if a, ok := d.pending[key]; ok {
+		a.count++
+		return true
+	}
+	d.seq++
+	d.pending[key] = &aggregate{
+		entry:    entry,
+		logger:   l,
+		count:    1,
+		deadline: time.Now().Add(d.window),
+		seq:      d.seq,
+	}
+	return true
+}
+
+// key identifies the entries that are collapsed together
+func (d *deduper) key(entry LogEntry) string {
+	var b strings.Builder
+	b.WriteString(entry.Level)
+	b.WriteByte(0)
+	b.WriteString(entry.Logger)
+	b.WriteByte(0)
+	b.WriteString(entry.Message)
+	for _, name := range d.keys {
+		b.WriteByte(0)
+		if value, ok := entry.Fields[name]; ok {
+			fmt.Fprintf(&b, "%s=%v", name, value)
+		}
+	}
+	return b.String()
+}
+
+// flush writes and removes the pending aggregates selected by due, in the
+// order their first entries were logged, and fires the hooks for them
+func (d *deduper) flush(due func(*aggregate) bool) {
+	d.mu.Lock()
+	var ready []*aggregate
+	for key, a := range d.pending {
+		if due(a) {
+			ready = append(ready, a)
+			delete(d.pending, key)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Slice(ready, func(i, j int) bool { return ready[i].seq < ready[j].seq })
+	for _, a := range ready {
+		fields := make(map[string]interface{}, len(a.entry.Fields)+1)
+		for k, v := range a.entry.Fields {
+			fields[k] = v
+		}
+		fields[OccurrencesField] = a.count
+		a.entry.Fields = fields
+
+		level := parseLogLevel(a.entry.Level)
+		a.logger.write(level, []byte(a.logger.formatEntry(a.entry)+"\n"))
+		a.logger.fireHooks(level, a.entry)
+	}
+}
+
+// close stops the background flusher and writes every pending aggregate.
+// Entries logged afterwards are written immediately.
+func (d *deduper) close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	d.closeOnce.Do(func() {
+		close(d.stop)
+		<-d.done
+	})
+	d.flush(func(*aggregate) bool { return true })
+}
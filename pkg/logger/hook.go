@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Hook receives entries after they are written, for shipping them to
+// external systems such as Sentry, Slack or a webhook. Fire is called
+// synchronously for entries at one of Levels, so slow hooks should hand the
+// entry off to a goroutine of their own. The entry's Fields must not be
+// modified.
+type Hook interface {
+	Levels() []LogLevel
+	Fire(entry LogEntry) error
+}
+
+// hookSet holds the hooks shared by a logger and the loggers derived from it
+type hookSet struct {
+	mu    sync.RWMutex
+	hooks map[LogLevel][]Hook
+}
+
+// AddHook registers hook for the levels it reports. Hooks are shared by
+// every logger derived from the same New, whether derived before or after
+// the call. An error returned by Fire is reported to the error handler and
+// the fallback output; a panic in Fire is recovered and reported the same
+// way. With deduplication, hooks fire once per collapsed entry when it is
+// written, with the count in OccurrencesField.
+func (l *Logger) AddHook(hook Hook) {
+	l.hooks.mu.Lock()
+	defer l.hooks.mu.Unlock()
+
+	if l.hooks.hooks == nil {
+		l.hooks.hooks = make(map[LogLevel][]Hook)
+	}
+	for _, level := range hook.Levels() {
+		l.hooks.hooks[level] = append(l.hooks.hooks[level], hook)
+	}
+}
+
+// fireHooks calls the hooks registered for level with entry
+func (l *Logger) fireHooks(level LogLevel, entry LogEntry) {
+	l.hooks.mu.RLock()
+	hooks := l.hooks.hooks[level]
+	l.hooks.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := l.fireHook(hook, entry); err != nil {
+			l.reportHookError(err)
+		}
+	}
+}
+
+// fireHook calls hook, turning a panic into an error
+func (l *Logger) fireHook(hook Hook, entry LogEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("hook %T panicked: %v", hook, r)
+		}
+	}()
+	return hook.Fire(entry)
+}
+
+// reportHookError reports a failed hook like a failed write, without
+// logging through the logger so that a broken hook cannot cause recursion
+func (l *Logger) reportHookError(err error) {
+	if l.onError != nil {
+		l.onError(err)
+	}
+	if l.fallback != nil {
+		fmt.Fprintf(l.fallback, "logger: hook failed: %v\n", err)
+	}
+}
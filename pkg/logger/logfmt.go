@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// formatLogfmt renders entry as a logfmt line: ts, level, caller, logger
+// and msg, then the fields sorted by key
+func formatLogfmt(entry LogEntry) string {
+	var b strings.Builder
+	writeLogfmtPair(&b, "ts", entry.Timestamp)
+	writeLogfmtPair(&b, "level", entry.Level)
+	if entry.Caller != "" {
+		writeLogfmtPair(&b, "caller", entry.Caller)
+	}
+	if entry.Logger != "" {
+		writeLogfmtPair(&b, "logger", entry.Logger)
+	}
+	writeLogfmtPair(&b, "msg", entry.Message)
+
+	keys := make([]string, 0, len(entry.Fields))
+	for k := range entry.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeLogfmtPair(&b, k, logfmtValue(entry.Fields[k]))
+	}
+	return b.String()
+}
+
+// logfmtValue converts a field value to the string written after "="
+func logfmtValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeLogfmtPair appends key=value, separated from any previous pair by a
+// space
+func writeLogfmtPair(b *strings.Builder, key, value string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	writeLogfmtKey(b, key)
+	b.WriteByte('=')
+	writeLogfmtString(b, value)
+}
+
+// writeLogfmtKey writes key with the characters logfmt does not allow in
+// keys replaced by underscores
+func writeLogfmtKey(b *strings.Builder, key string) {
+	if key == "" {
+		b.WriteString(BadKeyField)
+		return
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+}
+
+// writeLogfmtString writes value bare when it is a single token, and
+// quoted with backslash escapes otherwise
+func writeLogfmtString(b *strings.Builder, value string) {
+	if !needsLogfmtQuotes(value) {
+		b.WriteString(value)
+		return
+	}
+
+	b.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(b, `\u%04x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+}
+
+// needsLogfmtQuotes reports whether value would not parse back as a single
+// bare value
+func needsLogfmtQuotes(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
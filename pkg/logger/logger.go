@@ -1,23 +1,35 @@
 package logger
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 // LogLevel represents different logging levels
 type LogLevel int
 
 const (
-	DEBUG LogLevel = iota
+	// TRACE is the most verbose level, for diagnostics too detailed for DEBUG
+	TRACE LogLevel = iota
+	DEBUG
 	INFO
 	WARN
 	ERROR
@@ -27,6 +39,8 @@ const (
 // String returns the string representation of LogLevel
 func (l LogLevel) String() string {
 	switch l {
+	case TRACE:
+		return "TRACE"
 	case DEBUG:
 		return "DEBUG"
 	case INFO:
@@ -48,22 +62,68 @@ type LogFormat int
 const (
 	TextFormat LogFormat = iota
 	JSONFormat
+	// LogfmtFormat writes key=value pairs as described at
+	// https://brandur.org/logfmt
+	LogfmtFormat
 )
 
-// Logger represents a structured logger
+// ColorMode controls ANSI coloring of the level in text output
+type ColorMode int
+
+const (
+	// ColorAuto colors output only when it is written to a terminal
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+// ANSI escape sequences for level colors
+const (
+	colorReset  = "\x1b[0m"
+	colorGray   = "\x1b[90m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+)
+
+// Logger represents a structured logger. A Logger is safe to share across
+// goroutines: WithField, WithFields and the other derivation methods return
+// new loggers and never modify the receiver, and each entry is built from
+// a snapshot of the fields. SetLevel may be called at any time, for example
+// on a config reload. The other Set methods are not synchronized and should
+// be called before the logger is shared.
 type Logger struct {
-	level      LogLevel
+	level      atomic.Int32
 	format     LogFormat
 	output     io.Writer
 	fields     map[string]interface{}
 	callerSkip int
+	noEscape   bool
+	redact     map[string]bool
+	name       string
+	colorMode  ColorMode
+	color      bool
+	lazy       map[string]func() interface{}
+	fallback   io.Writer
+	onError    func(error)
+	exitCode   int
+	static     map[string]interface{}
+	dedup      *deduper
+	hooks      *hookSet
+	maxField   int
+	dropOnDone bool
+	ctx        context.Context
 }
 
+// exit terminates the process after a fatal entry; tests replace it
+var exit = os.Exit
+
 // LogEntry represents a single log entry
 type LogEntry struct {
 	Timestamp string                 `json:"timestamp"`
 	Level     string                 `json:"level"`
 	Message   string                 `json:"message"`
+	Logger    string                 `json:"logger,omitempty"`
 	Caller    string                 `json:"caller,omitempty"`
 	Fields    map[string]interface{} `json:"fields,omitempty"`
 }
@@ -74,21 +134,112 @@ type Config struct {
 	Format     string
 	Output     io.Writer
 	CallerSkip int
+
+	// DefaultFields are attached to every entry emitted by the logger
+	// and by any logger derived from it
+	DefaultFields map[string]interface{}
+
+	// DisableHTMLEscape writes <, > and & literally in JSON output instead
+	// of as \u003c, \u003e and \u0026, which keeps URLs readable
+	DisableHTMLEscape bool
+
+	// Color is "auto", "always" or "never" and controls whether the level
+	// is colored in text output. Auto, the default, colors only when Output
+	// is a terminal. JSON output is never colored.
+	Color string
+
+	// RedactFields lists field names, matched case-insensitively, whose
+	// values are replaced with "***" in log fields and logged request bodies
+	RedactFields []string
+
+	// FallbackOutput receives entries that could not be written to Output,
+	// preceded by a line describing the failure. Nil means os.Stderr.
+	FallbackOutput io.Writer
+
+	// ErrorOutput receives WARN, ERROR and FATAL entries from loggers
+	// created by NewSplit. Nil means os.Stderr. New ignores it.
+	ErrorOutput io.Writer
+
+	// ErrorHandler, if set, is called with every error from writing to
+	// Output, for example to count or alert on logging failures
+	ErrorHandler func(error)
+
+	// FatalExitCode is the process exit status used by Fatal. Zero means 1.
+	FatalExitCode int
+
+	// IncludeHost and IncludePID add "hostname" and "pid" fields to every
+	// entry. Both are resolved once by New and take precedence over fields
+	// of the same name added with WithField.
+	IncludeHost bool
+	IncludePID  bool
+
+	// DedupWindow, when positive, collapses entries with the same level,
+	// message and values of DedupFields logged within the window into a
+	// single entry with an "occurrences" field, written when the window
+	// closes. Fatal entries are never held back. Call Close to flush
+	// pending entries before exiting. Zero disables deduplication.
+	DedupWindow time.Duration
+	DedupFields []string
+
+	// MaxFieldValueBytes, when positive, truncates any field value whose
+	// serialized form is longer, keeping the first MaxFieldValueBytes
+	// bytes followed by "...(truncated)", in every format. Strings and
+	// byte slices are cut before they are encoded; other values are encoded
+	// as JSON first. Zero applies no limit.
+	MaxFieldValueBytes int
+
+	// DropWhenContextDone makes loggers returned by WithContext skip
+	// entries below ERROR once the context is done, so that a timed out or
+	// canceled request does not keep producing log output. Error and Fatal
+	// entries are always written.
+	DropWhenContextDone bool
 }
 
+// redactedValue replaces the values of redacted fields
+const redactedValue = "***"
+
 // New creates a new logger with the given configuration
 func New(config Config) *Logger {
 	logger := &Logger{
-		level:      parseLogLevel(config.Level),
 		format:     parseLogFormat(config.Format),
 		output:     config.Output,
 		fields:     make(map[string]interface{}),
 		callerSkip: config.CallerSkip,
+		noEscape:   config.DisableHTMLEscape,
+		colorMode:  parseColorMode(config.Color),
+		fallback:   config.FallbackOutput,
+		onError:    config.ErrorHandler,
+		exitCode:   config.FatalExitCode,
+		dropOnDone: config.DropWhenContextDone,
+		hooks:      &hookSet{},
+		maxField:   config.MaxFieldValueBytes,
+	}
+
+	logger.level.Store(int32(parseLogLevel(config.Level)))
+
+	if logger.exitCode == 0 {
+		logger.exitCode = 1
+	}
+
+	if logger.fallback == nil {
+		logger.fallback = os.Stderr
 	}
 
 	if logger.output == nil {
 		logger.output = os.Stdout
 	}
+	logger.color = useColor(logger.colorMode, logger.output)
+
+	logger.SetRedactFields(config.RedactFields)
+	logger.static = staticFields(config)
+
+	if config.DedupWindow > 0 {
+		logger.dedup = newDeduper(config.DedupWindow, config.DedupFields, logger.fallback)
+	}
+
+	for k, v := range config.DefaultFields {
+		logger.fields[k] = v
+	}
 
 	return logger
 }
@@ -106,6 +257,7 @@ func NewDefault() *Logger {
 func (l *Logger) WithField(key string, value interface{}) *Logger {
 	newLogger := l.clone()
 	newLogger.fields[key] = value
+	delete(newLogger.lazy, key)
 	return newLogger
 }
 
@@ -114,27 +266,130 @@ func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
 	newLogger := l.clone()
 	for k, v := range fields {
 		newLogger.fields[k] = v
+		delete(newLogger.lazy, k)
 	}
 	return newLogger
 }
 
-// WithContext extracts relevant information from context and adds it to logger
+// WithLazyField adds a field whose value is computed by fn only when an
+// entry is actually emitted. fn is not called for entries below the
+// logger's level, and is called again for every emitted entry, so it
+// should be safe to call repeatedly and from multiple goroutines. Use it
+// for values that are expensive to compute, such as debug dumps.
+func (l *Logger) WithLazyField(key string, fn func() interface{}) *Logger {
+	newLogger := l.clone()
+	delete(newLogger.fields, key)
+	if newLogger.lazy == nil {
+		newLogger.lazy = make(map[string]func() interface{})
+	}
+	newLogger.lazy[key] = fn
+	return newLogger
+}
+
+// IsLevelEnabled reports whether entries at level are emitted. Use it to
+// skip preparing data for entries that would be suppressed.
+func (l *Logger) IsLevelEnabled(level LogLevel) bool {
+	return level >= LogLevel(l.level.Load())
+}
+
+// Timer starts timing an operation and returns a function that, when
+// called, logs a DEBUG entry with the operation name and its duration in
+// the "operation" and "duration_ms" fields. Typical use is
+//
+//	defer log.Timer("load users")()
+func (l *Logger) Timer(name string) func() {
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		l.WithFields(map[string]interface{}{
+			"operation":   name,
+			"duration_ms": float64(elapsed.Microseconds()) / 1000,
+		}).log(DEBUG, "%s took %s", name, elapsed)
+	}
+}
+
+// Named returns a logger for a subsystem such as "http" or "db". Its
+// entries carry the name in the logger field. Nested calls join names with
+// a dot, so Named("http").Named("db") logs as "http.db".
+func (l *Logger) Named(name string) *Logger {
+	newLogger := l.clone()
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	newLogger.name = name
+	return newLogger
+}
+
+// ContextKey is the type of context keys read by WithContext
+type ContextKey string
+
+// Context keys read by WithContext
+const (
+	RequestIDKey ContextKey = "request_id"
+	UserIDKey    ContextKey = "user_id"
+)
+
+// WithContext extracts relevant information from context and adds it to
+// logger. With Config.DropWhenContextDone the logger also skips entries
+// below ERROR once ctx is done.
 func (l *Logger) WithContext(ctx context.Context) *Logger {
 	newLogger := l.clone()
+	if l.dropOnDone {
+		newLogger.ctx = ctx
+	}
 
 	// Extract request ID if available
-	if requestID := ctx.Value("request_id"); requestID != nil {
+	if requestID := contextValue(ctx, RequestIDKey); requestID != nil {
 		newLogger.fields["request_id"] = requestID
 	}
 
 	// Extract user ID if available
-	if userID := ctx.Value("user_id"); userID != nil {
+	if userID := contextValue(ctx, UserIDKey); userID != nil {
 		newLogger.fields["user_id"] = userID
 	}
 
 	return newLogger
 }
 
+// loggerKey is the context key for the logger stored by NewContext
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying l, for FromContext and
+// FromRequest
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx by NewContext. Without one
+// it returns the global logger with the fields of WithContext(ctx).
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return defaultLogger.WithContext(ctx)
+}
+
+// FromRequest returns the logger for r. Behind the app's request ID
+// middleware it carries the request_id field, so handler entries can be
+// correlated with the request's access log entry.
+func FromRequest(r *http.Request) *Logger {
+	return FromContext(r.Context())
+}
+
+// contextValue looks up key, falling back to the plain string key that
+// callers used before ContextKey existed
+func contextValue(ctx context.Context, key ContextKey) interface{} {
+	if v := ctx.Value(key); v != nil {
+		return v
+	}
+	return ctx.Value(string(key))
+}
+
+// Trace logs a trace level message
+func (l *Logger) Trace(msg string, args ...interface{}) {
+	l.log(TRACE, msg, args...)
+}
+
 // Debug logs a debug level message
 func (l *Logger) Debug(msg string, args ...interface{}) {
 	l.log(DEBUG, msg, args...)
@@ -155,16 +410,131 @@ func (l *Logger) Error(msg string, args ...interface{}) {
 	l.log(ERROR, msg, args...)
 }
 
-// Fatal logs a fatal level message and exits
+// ErrorReturn logs msg at error level with err in the "error" field and
+// returns err, for the log-and-return pattern:
+//
+//	if err != nil {
+//		return log.ErrorReturn(err, "loading user %s", id)
+//	}
+//
+// A nil err is returned without logging.
+func (l *Logger) ErrorReturn(err error, msg string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	if l.IsLevelEnabled(ERROR) {
+		l.WithField("error", err.Error()).log(ERROR, msg, args...)
+	}
+	return err
+}
+
+// WrapError logs msg at error level like ErrorReturn and returns err
+// wrapped as "msg: err", so errors.Is and errors.As still find err. A nil
+// err is returned without logging.
+func (l *Logger) WrapError(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	if l.IsLevelEnabled(ERROR) {
+		l.WithField("error", err.Error()).log(ERROR, "%s", msg)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// Fatal logs a fatal level message and exits with the configured
+// FatalExitCode, 1 by default
 func (l *Logger) Fatal(msg string, args ...interface{}) {
 	l.log(FATAL, msg, args...)
-	os.Exit(1)
+	l.exit(l.exitCode)
+}
+
+// FatalWithCode logs a fatal level message and exits with the given code,
+// for callers that report distinct failures to an orchestrator
+func (l *Logger) FatalWithCode(code int, msg string, args ...interface{}) {
+	l.log(FATAL, msg, args...)
+	l.exit(code)
+}
+
+// BadKeyField holds the value left over when a sugared method such as
+// Infow receives an odd number of key/value arguments
+const BadKeyField = "!badkey"
+
+// Debugw logs msg verbatim at debug level with keysAndValues, alternating
+// keys and values, added as fields
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	if l.IsLevelEnabled(DEBUG) {
+		l.withKeysAndValues(keysAndValues).log(DEBUG, "%s", msg)
+	}
+}
+
+// Infow logs msg verbatim at info level with keysAndValues, alternating
+// keys and values, added as fields. Unlike Info, msg is not a format
+// string:
+//
+//	log.Infow("User logged in", "user_id", id, "method", "password")
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	if l.IsLevelEnabled(INFO) {
+		l.withKeysAndValues(keysAndValues).log(INFO, "%s", msg)
+	}
 }
 
-// log is the internal logging function
+// Warnw logs msg verbatim at warn level with keysAndValues, alternating
+// keys and values, added as fields
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	if l.IsLevelEnabled(WARN) {
+		l.withKeysAndValues(keysAndValues).log(WARN, "%s", msg)
+	}
+}
+
+// Errorw logs msg verbatim at error level with keysAndValues, alternating
+// keys and values, added as fields
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	if l.IsLevelEnabled(ERROR) {
+		l.withKeysAndValues(keysAndValues).log(ERROR, "%s", msg)
+	}
+}
+
+// withKeysAndValues returns a logger with alternating keys and values added
+// as fields. Keys that are not strings are formatted with fmt.Sprint, and a
+// trailing key without a value is added as the value of BadKeyField.
+func (l *Logger) withKeysAndValues(keysAndValues []interface{}) *Logger {
+	fields := make(map[string]interface{}, (len(keysAndValues)+1)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			fields[BadKeyField] = keysAndValues[i]
+			break
+		}
+
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		fields[key] = keysAndValues[i+1]
+	}
+	return l.WithFields(fields)
+}
+
+// exit flushes the output, if it supports it, so the final entry is not
+// lost, and terminates the process
+func (l *Logger) exit(code int) {
+	l.Close()
+	if s, ok := l.output.(interface{ Sync() error }); ok {
+		s.Sync()
+	}
+	exit(code)
+}
+
+// log is the internal logging function. The level check comes first, so a
+// call at a disabled level reads no clock, fields or caller and does not
+// allocate; BenchmarkDisabledDebug guards this. Arguments are still
+// converted to interface values at the call site, which allocates for
+// values such as non-constant strings and large integers, so callers
+// should guard expensive arguments with IsLevelEnabled.
 func (l *Logger) log(level LogLevel, msg string, args ...interface{}) {
-	// Check if we should log this level
-	if level < l.level {
+	if !l.IsLevelEnabled(level) {
+		return
+	}
+	if level < ERROR && l.ctx != nil && l.ctx.Err() != nil {
 		return
 	}
 
@@ -176,28 +546,53 @@ func (l *Logger) log(level LogLevel, msg string, args ...interface{}) {
 
 	// Create log entry
 	entry := LogEntry{
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Timestamp: time.Now().UTC().Format(timestampFormat),
 		Level:     level.String(),
 		Message:   message,
-		Fields:    l.fields,
+		Logger:    l.name,
+		Fields:    l.truncateFields(l.redactFields(l.evaluateFields())),
 	}
 
 	// Add caller information
-	if level >= ERROR || l.level == DEBUG {
+	if level >= ERROR || LogLevel(l.level.Load()) <= DEBUG {
 		if caller := l.getCaller(); caller != "" {
 			entry.Caller = caller
 		}
 	}
 
+	if l.dedup != nil {
+		if level >= FATAL {
+			// The process is about to exit; write what was held back
+			// first so that the fatal entry is the last one
+			l.dedup.flush(func(*aggregate) bool { return true })
+		} else if l.dedup.add(l, entry) {
+			return
+		}
+	}
+
 	// Output the log entry
-	l.output.Write([]byte(l.formatEntry(entry) + "\n"))
+	l.write(level, []byte(l.formatEntry(entry)+"\n"))
+	l.fireHooks(level, entry)
+}
+
+// Close writes entries held back by deduplication and stops its background
+// flusher. Loggers derived from the same New share deduplication, so
+// closing any of them closes it for all. Close is a no-op without
+// DedupWindow and is safe to call more than once.
+func (l *Logger) Close() error {
+	if l.dedup != nil {
+		l.dedup.close()
+	}
+	return nil
 }
 
 // formatEntry formats the log entry based on the configured format
 func (l *Logger) formatEntry(entry LogEntry) string {
+	entry.Fields = coerceFields(entry.Fields)
+
 	switch l.format {
 	case JSONFormat:
-		if data, err := json.Marshal(entry); err == nil {
+		if data, err := l.marshalJSON(entry); err == nil {
 			return string(data)
 		}
 		// Fallback to text format if JSON marshaling fails
@@ -205,27 +600,54 @@ func (l *Logger) formatEntry(entry LogEntry) string {
 	case TextFormat:
 		var parts []string
 		parts = append(parts, entry.Timestamp)
-		parts = append(parts, fmt.Sprintf("[%s]", entry.Level))
+		parts = append(parts, l.colorize(entry.Level, fmt.Sprintf("[%s]", entry.Level)))
 		if entry.Caller != "" {
 			parts = append(parts, fmt.Sprintf("(%s)", entry.Caller))
 		}
+		if entry.Logger != "" {
+			parts = append(parts, entry.Logger+":")
+		}
 		parts = append(parts, entry.Message)
 
-		// Add fields
+		// Add fields, sorted by key so that output is stable. JSON needs no
+		// such step because encoding/json already sorts map keys.
 		if len(entry.Fields) > 0 {
-			var fieldParts []string
-			for k, v := range entry.Fields {
-				fieldParts = append(fieldParts, fmt.Sprintf("%s=%v", k, v))
+			keys := make([]string, 0, len(entry.Fields))
+			for k := range entry.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			fieldParts := make([]string, len(keys))
+			for i, k := range keys {
+				fieldParts[i] = fmt.Sprintf("%s=%v", k, entry.Fields[k])
 			}
 			parts = append(parts, fmt.Sprintf("{%s}", strings.Join(fieldParts, ", ")))
 		}
 
 		return strings.Join(parts, " ")
+	case LogfmtFormat:
+		return formatLogfmt(entry)
 	default:
 		return entry.Message
 	}
 }
 
+// marshalJSON encodes entry, escaping HTML characters unless disabled
+func (l *Logger) marshalJSON(entry LogEntry) ([]byte, error) {
+	if !l.noEscape {
+		return json.Marshal(entry)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entry); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
 // getCaller returns the caller information
 func (l *Logger) getCaller() string {
 	_, file, line, ok := runtime.Caller(3 + l.callerSkip)
@@ -249,48 +671,315 @@ func (l *Logger) clone() *Logger {
 		newFields[k] = v
 	}
 
-	return &Logger{
-		level:      l.level,
+	var newLazy map[string]func() interface{}
+	if len(l.lazy) > 0 {
+		newLazy = make(map[string]func() interface{}, len(l.lazy))
+		for k, fn := range l.lazy {
+			newLazy[k] = fn
+		}
+	}
+
+	newLogger := &Logger{
 		format:     l.format,
 		output:     l.output,
 		fields:     newFields,
 		callerSkip: l.callerSkip,
+		noEscape:   l.noEscape,
+		redact:     l.redact,
+		name:       l.name,
+		colorMode:  l.colorMode,
+		color:      l.color,
+		lazy:       newLazy,
+		fallback:   l.fallback,
+		onError:    l.onError,
+		exitCode:   l.exitCode,
+		static:     l.static,
+		dedup:      l.dedup,
+		hooks:      l.hooks,
+		maxField:   l.maxField,
+		dropOnDone: l.dropOnDone,
+		ctx:        l.ctx,
 	}
+	newLogger.level.Store(l.level.Load())
+	return newLogger
 }
 
-// parseLogLevel parses a string log level into LogLevel
-func parseLogLevel(level string) LogLevel {
-	switch strings.ToUpper(level) {
-	case "DEBUG":
-		return DEBUG
-	case "INFO":
-		return INFO
-	case "WARN", "WARNING":
-		return WARN
-	case "ERROR":
-		return ERROR
-	case "FATAL":
-		return FATAL
+// write writes a formatted line to the output. If that fails, the error is
+// reported to the error handler and the line is written to the fallback
+// writer instead. Failures of the fallback are ignored; nothing here logs
+// through the logger, so a broken sink cannot cause recursion.
+func (l *Logger) write(level LogLevel, line []byte) {
+	var err error
+	if lw, ok := l.output.(levelWriter); ok {
+		_, err = lw.WriteLevel(level, line)
+	} else {
+		_, err = l.output.Write(line)
+	}
+	if err == nil {
+		return
+	}
+
+	if l.onError != nil {
+		l.onError(err)
+	}
+	if l.fallback != nil && l.fallback != l.output {
+		fmt.Fprintf(l.fallback, "logger: write to log output failed: %v\n", err)
+		l.fallback.Write(line)
+	}
+}
+
+// evaluateFields returns a snapshot of the logger's fields with lazy fields
+// computed and the static fields applied last. The entry owns the snapshot,
+// so sinks that format it later never share a map with the logger.
+func (l *Logger) evaluateFields() map[string]interface{} {
+	if len(l.fields) == 0 && len(l.lazy) == 0 && len(l.static) == 0 {
+		return nil
+	}
+
+	fields := make(map[string]interface{}, len(l.fields)+len(l.lazy)+len(l.static))
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, fn := range l.lazy {
+		fields[k] = fn()
+	}
+	for k, v := range l.static {
+		fields[k] = v
+	}
+	return fields
+}
+
+// staticFields resolves the per-process fields requested by config
+func staticFields(config Config) map[string]interface{} {
+	static := make(map[string]interface{})
+	if config.IncludeHost {
+		if hostname, err := os.Hostname(); err == nil {
+			static["hostname"] = hostname
+		}
+	}
+	if config.IncludePID {
+		static["pid"] = os.Getpid()
+	}
+	if len(static) == 0 {
+		return nil
+	}
+	return static
+}
+
+// redactFields masks redacted values in fields, which must be a snapshot
+// owned by the caller
+func (l *Logger) redactFields(fields map[string]interface{}) map[string]interface{} {
+	for k := range fields {
+		if l.redact[strings.ToLower(k)] {
+			fields[k] = redactedValue
+		}
+	}
+	return fields
+}
+
+// truncatedSuffix marks a field value cut to MaxFieldValueBytes
+const truncatedSuffix = "...(truncated)"
+
+// truncateFields shortens field values longer than MaxFieldValueBytes. It
+// modifies fields, which must be the entry's own snapshot.
+func (l *Logger) truncateFields(fields map[string]interface{}) map[string]interface{} {
+	if l.maxField <= 0 {
+		return fields
+	}
+	for k, v := range fields {
+		if truncated, ok := truncateValue(v, l.maxField); ok {
+			fields[k] = truncated
+		}
+	}
+	return fields
+}
+
+// truncateValue returns v cut to limit bytes and true, or false if v fits
+func truncateValue(v interface{}, limit int) (string, bool) {
+	var serialized string
+	switch v := v.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return "", false
+	case string:
+		serialized = v
+	case []byte:
+		serialized = string(v[:min(len(v), limit+1)])
 	default:
-		return INFO
+		if s, ok := coerceValue(v); ok {
+			serialized = s
+			break
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		serialized = string(data)
+	}
+
+	if len(serialized) <= limit {
+		return "", false
 	}
+	cut := limit
+	// Do not split a multi-byte character
+	for cut > 0 && !utf8.RuneStart(serialized[cut]) {
+		cut--
+	}
+	return serialized[:cut] + truncatedSuffix, true
 }
 
-// parseLogFormat parses a string log format into LogFormat
-func parseLogFormat(format string) LogFormat {
-	switch strings.ToLower(format) {
-	case "json":
-		return JSONFormat
-	case "text", "plain":
-		return TextFormat
+// redactValue masks redacted keys in a decoded JSON value, recursing into
+// nested objects and arrays
+func (l *Logger) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, inner := range v {
+			if l.redact[strings.ToLower(k)] {
+				v[k] = redactedValue
+			} else {
+				v[k] = l.redactValue(inner)
+			}
+		}
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = l.redactValue(inner)
+		}
+	}
+	return value
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN", as accepted in
+// Config.Level. Unknown names yield INFO; use ParseLevelStrict to reject
+// them instead.
+func ParseLevel(level string) LogLevel {
+	return parseLogLevel(level)
+}
+
+// Errors returned by the strict parsers
+var (
+	ErrInvalidLevel  = errors.New("invalid log level")
+	ErrInvalidFormat = errors.New("invalid log format")
+)
+
+// levelNames maps the accepted level names, including aliases, to levels
+var levelNames = []struct {
+	name  string
+	level LogLevel
+}{
+	{"trace", TRACE},
+	{"debug", DEBUG},
+	{"info", INFO},
+	{"warn", WARN},
+	{"warning", WARN},
+	{"error", ERROR},
+	{"fatal", FATAL},
+}
+
+// formatNames maps the accepted format names, including aliases, to formats
+var formatNames = []struct {
+	name   string
+	format LogFormat
+}{
+	{"json", JSONFormat},
+	{"text", TextFormat},
+	{"plain", TextFormat},
+	{"logfmt", LogfmtFormat},
+}
+
+// ParseLevelStrict parses a level name case-insensitively. Unknown names
+// return an error wrapping ErrInvalidLevel that lists the valid names.
+func ParseLevelStrict(level string) (LogLevel, error) {
+	names := make([]string, len(levelNames))
+	for i, n := range levelNames {
+		if strings.EqualFold(level, n.name) {
+			return n.level, nil
+		}
+		names[i] = n.name
+	}
+	return INFO, fmt.Errorf("%w %q, valid levels are %s", ErrInvalidLevel, level, strings.Join(names, ", "))
+}
+
+// ParseFormatStrict parses a format name case-insensitively. Unknown names
+// return an error wrapping ErrInvalidFormat that lists the valid names.
+func ParseFormatStrict(format string) (LogFormat, error) {
+	names := make([]string, len(formatNames))
+	for i, n := range formatNames {
+		if strings.EqualFold(format, n.name) {
+			return n.format, nil
+		}
+		names[i] = n.name
+	}
+	return JSONFormat, fmt.Errorf("%w %q, valid formats are %s", ErrInvalidFormat, format, strings.Join(names, ", "))
+}
+
+// parseLogLevel parses a string log level into LogLevel, defaulting to INFO
+func parseLogLevel(level string) LogLevel {
+	l, _ := ParseLevelStrict(level)
+	return l
+}
+
+// parseColorMode parses a string color mode into ColorMode
+func parseColorMode(mode string) ColorMode {
+	switch strings.ToLower(mode) {
+	case "always":
+		return ColorAlways
+	case "never":
+		return ColorNever
 	default:
-		return JSONFormat
+		return ColorAuto
+	}
+}
+
+// useColor reports whether text written to output should be colored
+func useColor(mode ColorMode, output io.Writer) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	// https://no-color.org
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := output.(*os.File)
+	if !ok {
+		return false
 	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-// SetLevel sets the logging level
+// colorize wraps text in the ANSI color for level when coloring is enabled
+func (l *Logger) colorize(level, text string) string {
+	if !l.color || l.format != TextFormat {
+		return text
+	}
+
+	color := colorGray
+	switch level {
+	case "INFO":
+		color = colorGreen
+	case "WARN":
+		color = colorYellow
+	case "ERROR", "FATAL":
+		color = colorRed
+	}
+	return color + text + colorReset
+}
+
+// parseLogFormat parses a string log format into LogFormat, defaulting to
+// JSON
+func parseLogFormat(format string) LogFormat {
+	f, _ := ParseFormatStrict(format)
+	return f
+}
+
+// SetLevel sets the logging level. It is safe to call while the logger is
+// in use. Loggers already derived with WithField and similar methods keep
+// the level they were created with.
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	l.level.Store(int32(level))
 }
 
 // SetFormat sets the logging format
@@ -298,15 +987,40 @@ func (l *Logger) SetFormat(format LogFormat) {
 	l.format = format
 }
 
+// SetEscapeHTML sets whether <, > and & are escaped in JSON output
+func (l *Logger) SetEscapeHTML(escape bool) {
+	l.noEscape = !escape
+}
+
+// SetRedactFields replaces the list of field names whose values are masked
+func (l *Logger) SetRedactFields(names []string) {
+	redact := make(map[string]bool, len(names))
+	for _, name := range names {
+		redact[strings.ToLower(name)] = true
+	}
+	l.redact = redact
+}
+
 // SetOutput sets the output writer
 func (l *Logger) SetOutput(output io.Writer) {
 	l.output = output
+	l.color = useColor(l.colorMode, output)
+}
+
+// SetColor sets the color mode for text output
+func (l *Logger) SetColor(mode ColorMode) {
+	l.colorMode = mode
+	l.color = useColor(mode, l.output)
 }
 
 // Global logger instance
 var defaultLogger = NewDefault()
 
 // Global logging functions
+func Trace(msg string, args ...interface{}) {
+	defaultLogger.Trace(msg, args...)
+}
+
 func Debug(msg string, args ...interface{}) {
 	defaultLogger.Debug(msg, args...)
 }
@@ -327,6 +1041,10 @@ func Fatal(msg string, args ...interface{}) {
 	defaultLogger.Fatal(msg, args...)
 }
 
+func FatalWithCode(code int, msg string, args ...interface{}) {
+	defaultLogger.FatalWithCode(code, msg, args...)
+}
+
 func WithField(key string, value interface{}) *Logger {
 	return defaultLogger.WithField(key, value)
 }
@@ -339,6 +1057,47 @@ func WithContext(ctx context.Context) *Logger {
 	return defaultLogger.WithContext(ctx)
 }
 
+// Context-aware global logging functions. They log through the global
+// logger with the request and user IDs from ctx, like
+// WithContext(ctx).Info(...), and report the caller's file and line.
+func TraceCtx(ctx context.Context, msg string, args ...interface{}) {
+	logCtx(ctx, TRACE, msg, args...)
+}
+
+func DebugCtx(ctx context.Context, msg string, args ...interface{}) {
+	logCtx(ctx, DEBUG, msg, args...)
+}
+
+func InfoCtx(ctx context.Context, msg string, args ...interface{}) {
+	logCtx(ctx, INFO, msg, args...)
+}
+
+func WarnCtx(ctx context.Context, msg string, args ...interface{}) {
+	logCtx(ctx, WARN, msg, args...)
+}
+
+func ErrorCtx(ctx context.Context, msg string, args ...interface{}) {
+	logCtx(ctx, ERROR, msg, args...)
+}
+
+func FatalCtx(ctx context.Context, msg string, args ...interface{}) {
+	logCtx(ctx, FATAL, msg, args...)
+	defaultLogger.exit(defaultLogger.exitCode)
+}
+
+// logCtx logs through the global logger with the fields from ctx. The
+// extra caller skip accounts for the exported wrapper, so getCaller
+// reports the code that called it.
+func logCtx(ctx context.Context, level LogLevel, msg string, args ...interface{}) {
+	// Check before WithContext, which copies the logger
+	if !defaultLogger.IsLevelEnabled(level) {
+		return
+	}
+	l := defaultLogger.WithContext(ctx)
+	l.callerSkip++
+	l.log(level, msg, args...)
+}
+
 // SetGlobalLogger sets the global logger instance
 func SetGlobalLogger(logger *Logger) {
 	defaultLogger = logger
@@ -349,40 +1108,366 @@ func GetGlobalLogger() *Logger {
 	return defaultLogger
 }
 
+// SetLevel sets the minimum level of the global logger
+func SetLevel(level LogLevel) {
+	defaultLogger.SetLevel(level)
+}
+
+// HTTPLogOptions configures HTTPLogMiddlewareWithOptions
+type HTTPLogOptions struct {
+	// LogRequestBody adds JSON and text request bodies to the access log as
+	// the request_body field. JSON bodies are logged as structured values
+	// with the logger's redacted fields masked. Only what the handler reads
+	// is logged; the middleware never reads the body itself.
+	LogRequestBody bool
+
+	// MaxBodyBytes caps how much of the body is captured. Zero means
+	// DefaultMaxBodyBytes.
+	MaxBodyBytes int
+
+	// AccessFormat is AccessFormatJSON, the default, or AccessFormatCommon
+	// or AccessFormatCombined to write plain access log lines that existing
+	// log tooling understands. Plain lines carry no extra fields.
+	AccessFormat string
+
+	// SlowThreshold, when positive, logs JSON access entries for requests
+	// that take longer than it at WARN with a "slow" field set to true,
+	// instead of at INFO
+	SlowThreshold time.Duration
+
+	// ExcludePaths lists request paths that are not logged, such as health
+	// checks and metrics scrapes. A path is excluded when it equals an
+	// entry or is below it, so "/metrics" also excludes "/metrics/go".
+	ExcludePaths []string
+
+	// ClientIP, when set, returns the client IP of a request, such as one
+	// taken from X-Forwarded-For behind a trusted proxy. JSON entries get
+	// it as the client_ip field and plain lines use it as the host.
+	ClientIP func(r *http.Request) string
+}
+
+// DefaultMaxBodyBytes is the default cap on captured request bodies
+const DefaultMaxBodyBytes = 4096
+
 // HTTPLogMiddleware creates a logging middleware for HTTP requests
 func (l *Logger) HTTPLogMiddleware() func(next http.Handler) http.Handler {
+	return l.HTTPLogMiddlewareWithOptions(HTTPLogOptions{})
+}
+
+// HTTPLogMiddlewareWithOptions creates a logging middleware for HTTP
+// requests configured by opts
+func (l *Logger) HTTPLogMiddlewareWithOptions(opts HTTPLogOptions) func(next http.Handler) http.Handler {
+	maxBody := opts.MaxBodyBytes
+	if maxBody <= 0 {
+		maxBody = DefaultMaxBodyBytes
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if excludedPath(r.URL.Path, opts.ExcludePaths) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			start := time.Now()
 
+			var recorder *bodyRecorder
+			if opts.LogRequestBody {
+				recorder = recordBody(r, maxBody)
+			}
+
 			// Create a response writer wrapper to capture status code
 			wrapped := &responseWriterWrapper{ResponseWriter: w, statusCode: 200}
 
+			// Let inner handlers contribute fields to the access log entry
+			extra := &accessFields{fields: make(map[string]interface{})}
+			r = r.WithContext(context.WithValue(r.Context(), accessFieldsKey{}, extra))
+
 			next.ServeHTTP(wrapped, r)
+			elapsed := time.Since(start)
 
-			l.WithFields(map[string]interface{}{
-				"method":      r.Method,
-				"url":         r.URL.String(),
-				"remote_addr": r.RemoteAddr,
-				"user_agent":  r.UserAgent(),
-				"status_code": wrapped.statusCode,
-				"duration":    time.Since(start).String(),
-			}).Info("HTTP request")
+			if opts.AccessFormat == AccessFormatCommon || opts.AccessFormat == AccessFormatCombined {
+				if l.IsLevelEnabled(INFO) {
+					line := formatAccessLine(opts.AccessFormat, r, opts.ClientIP, start, wrapped.statusCode, wrapped.bytesWritten)
+					l.write(INFO, []byte(line+"\n"))
+				}
+				return
+			}
+
+			fields := map[string]interface{}{
+				"method":        r.Method,
+				"url":           r.URL.String(),
+				"remote_addr":   r.RemoteAddr,
+				"user_agent":    r.UserAgent(),
+				"status_code":   wrapped.statusCode,
+				"bytes_written": wrapped.bytesWritten,
+				"duration":      elapsed.String(),
+			}
+			if opts.ClientIP != nil {
+				fields["client_ip"] = opts.ClientIP(r)
+			}
+
+			for k, v := range l.bodyFields(recorder) {
+				fields[k] = v
+			}
+
+			// Only available behind a proxy that stamps X-Request-Start
+			if received, ok := parseRequestStart(r.Header.Get(RequestStartHeader)); ok {
+				end := time.Now()
+				queue := start.Sub(received)
+				if queue < 0 {
+					// Clocks of the proxy and this host can disagree
+					queue = 0
+				}
+				fields["queue_time_ms"] = milliseconds(queue)
+				fields["total_latency_ms"] = milliseconds(queue + end.Sub(start))
+			}
+
+			extra.mu.Lock()
+			for k, v := range extra.fields {
+				fields[k] = v
+			}
+			extra.mu.Unlock()
+
+			if wrapped.superfluous {
+				fields["superfluous_writeheader"] = true
+			}
+
+			// Only available when the server installs ConnContext
+			if conn, ok := r.Context().Value(connInfoKey{}).(*connInfo); ok {
+				fields["conn_reused"] = atomic.AddInt64(&conn.requests, 1) > 1
+			}
+
+			if opts.SlowThreshold > 0 && elapsed > opts.SlowThreshold {
+				fields["slow"] = true
+				l.WithFields(fields).Warn("HTTP request")
+				return
+			}
+			l.WithFields(fields).Info("HTTP request")
 		})
 	}
 }
 
+// RequestStartHeader carries the time a proxy received the request, as set
+// by nginx, HAProxy and Heroku's router
+const RequestStartHeader = "X-Request-Start"
+
+// excludedPath reports whether path equals one of excluded or is below it
+func excludedPath(path string, excluded []string) bool {
+	for _, prefix := range excluded {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRequestStart parses an X-Request-Start value. The value may have a
+// "t=" prefix and be a Unix timestamp in seconds, milliseconds,
+// microseconds or nanoseconds; the unit is inferred from its magnitude.
+func parseRequestStart(value string) (time.Time, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "t=")
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	ts, err := strconv.ParseFloat(value, 64)
+	if err != nil || ts <= 0 {
+		return time.Time{}, false
+	}
+
+	switch {
+	case ts > 1e17:
+		return time.Unix(0, int64(ts)), true
+	case ts > 1e14:
+		return time.UnixMicro(int64(ts)), true
+	case ts > 1e11:
+		return time.UnixMilli(int64(ts)), true
+	default:
+		return time.Unix(0, int64(ts*1e9)), true
+	}
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// bodyRecorder copies the start of a request body as the handler reads it.
+// Nothing is read ahead of the handler, so a body that inner middleware
+// rejects unread, such as one over the size limit, stays unread and
+// clients sending "Expect: 100-continue" are not asked to send it.
+type bodyRecorder struct {
+	io.ReadCloser
+	max      int
+	json     bool
+	captured bytes.Buffer
+}
+
+// recordBody starts recording a JSON or text request body, keeping up to
+// max bytes plus one to tell whether it was truncated. It returns nil for
+// other bodies.
+func recordBody(r *http.Request, max int) *bodyRecorder {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isJSON := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	if !isJSON && !strings.HasPrefix(mediaType, "text/") {
+		return nil
+	}
+
+	recorder := &bodyRecorder{ReadCloser: r.Body, max: max, json: isJSON}
+	r.Body = recorder
+	return recorder
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.max + 1 - b.captured.Len(); room > 0 {
+		b.captured.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// bodyFields returns the access log fields describing the part of the
+// request body the handler read, or nil if it read none
+func (l *Logger) bodyFields(b *bodyRecorder) map[string]interface{} {
+	if b == nil || b.captured.Len() == 0 {
+		return nil
+	}
+
+	captured := b.captured.Bytes()
+	truncated := len(captured) > b.max
+	if truncated {
+		captured = captured[:b.max]
+	}
+	fields := map[string]interface{}{}
+	if truncated {
+		fields["request_body_truncated"] = true
+	}
+
+	if !b.json {
+		fields["request_body"] = string(captured)
+		return fields
+	}
+
+	// Partial or invalid JSON cannot be redacted, so it is left out
+	var decoded interface{}
+	if truncated || json.Unmarshal(captured, &decoded) != nil {
+		return fields
+	}
+	fields["request_body"] = l.redactValue(decoded)
+	return fields
+}
+
+// accessFieldsKey is the context key for fields added to the access log
+type accessFieldsKey struct{}
+
+// accessFields holds fields added by handlers during a request
+type accessFields struct {
+	mu     sync.Mutex
+	fields map[string]interface{}
+}
+
+// AddAccessLogField adds a field to the access log entry that
+// HTTPLogMiddleware writes for the request carrying ctx. It does nothing
+// if the request is not being logged by HTTPLogMiddleware.
+func AddAccessLogField(ctx context.Context, key string, value interface{}) {
+	extra, ok := ctx.Value(accessFieldsKey{}).(*accessFields)
+	if !ok {
+		return
+	}
+
+	extra.mu.Lock()
+	extra.fields[key] = value
+	extra.mu.Unlock()
+}
+
+// connInfoKey is the context key for per-connection state
+type connInfoKey struct{}
+
+// connInfo tracks the number of requests served on a single connection
+type connInfo struct {
+	requests int64
+}
+
+// ConnContext is a hook for http.Server.ConnContext that lets
+// HTTPLogMiddleware log whether a request arrived on a new or a reused
+// keep-alive connection as the conn_reused field
+func ConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connInfoKey{}, &connInfo{})
+}
+
 // responseWriterWrapper wraps http.ResponseWriter to capture status code
+// and the number of body bytes written
 type responseWriterWrapper struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int64
+	wroteHeader  bool
+	// superfluous is set when the handler called WriteHeader again after
+	// the header was written, which is almost always a handler bug
+	superfluous bool
 }
 
+// WriteHeader records the status code of the first call and, like
+// net/http, ignores later ones. Informational 1xx headers other than 101
+// are passed through since a handler may send several before the final
+// status.
 func (w *responseWriterWrapper) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		w.superfluous = true
+		return
+	}
+	if statusCode >= 100 && statusCode <= 199 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.wroteHeader = true
 	w.statusCode = statusCode
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Write sends an implicit 200 status if the handler has not written one
+func (w *responseWriterWrapper) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+// Flush forwards to the underlying writer so streaming responses work
+// behind the middleware. Flushing writes the header, so a later
+// WriteHeader is superfluous.
+func (w *responseWriterWrapper) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer so WebSocket upgrades work
+// behind the middleware
+func (w *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack: %w", http.ErrNotSupported)
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // Standard library logger adapter
 func (l *Logger) StdLogger() *log.Logger {
 	return log.New(&loggerWriter{l}, "", 0)
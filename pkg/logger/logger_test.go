@@ -0,0 +1,1654 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeEntries(t *testing.T, buf *bytes.Buffer) []LogEntry {
+	t.Helper()
+
+	var entries []LogEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry LogEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestDefaultFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{
+		Level:  "debug",
+		Format: "json",
+		Output: &buf,
+		DefaultFields: map[string]interface{}{
+			"service": "beto",
+			"version": "1.0.0",
+		},
+	})
+
+	log.Info("first")
+	log.WithField("request_id", "abc").Warn("second")
+	log.WithFields(map[string]interface{}{"user_id": 42}).Error("third")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.Equal(t, "beto", entry.Fields["service"])
+		assert.Equal(t, "1.0.0", entry.Fields["version"])
+	}
+	assert.Equal(t, "abc", entries[1].Fields["request_id"])
+}
+
+func TestHTTPLogMiddlewareConnectionReuse(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	handler := log.HTTPLogMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	defer server.Close()
+
+	client := server.Client()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, false, entries[0].Fields["conn_reused"])
+	assert.Equal(t, true, entries[1].Fields["conn_reused"])
+}
+
+func TestAddAccessLogField(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	handler := log.HTTPLogMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddAccessLogField(r.Context(), "cache", "hit")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "hit", entries[0].Fields["cache"])
+
+	// Outside the middleware the call is a no-op
+	AddAccessLogField(httptest.NewRequest("GET", "/", nil).Context(), "cache", "hit")
+}
+
+func TestWithContextKeys(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	ctx := context.WithValue(context.Background(), UserIDKey, "user-42")
+	ctx = context.WithValue(ctx, "request_id", "req-1") //nolint:staticcheck // legacy string key
+	log.WithContext(ctx).Info("request")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "user-42", entries[0].Fields["user_id"])
+	assert.Equal(t, "req-1", entries[0].Fields["request_id"])
+}
+
+func TestFromRequest(t *testing.T) {
+	var buf bytes.Buffer
+	previous := GetGlobalLogger()
+	SetGlobalLogger(New(Config{Level: "info", Format: "json", Output: &buf}))
+	defer SetGlobalLogger(previous)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := context.WithValue(req.Context(), RequestIDKey, "req-1")
+	req = req.WithContext(ctx)
+
+	// Without a stored logger the global one is used with the context fields
+	FromRequest(req).Info("global")
+
+	var stored bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &stored}).WithField("component", "api")
+	FromRequest(req.WithContext(NewContext(ctx, log))).Info("stored")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "req-1", entries[0].Fields["request_id"])
+
+	entries = decodeEntries(t, &stored)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "api", entries[0].Fields["component"])
+	assert.NotContains(t, entries[0].Fields, "request_id", "a stored logger is returned as is")
+}
+
+func TestMaxFieldValueBytes(t *testing.T) {
+	large := strings.Repeat("x", 1<<20)
+
+	for _, format := range []string{"json", "text", "logfmt"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: format, Output: &buf, MaxFieldValueBytes: 16})
+
+			log.WithField("payload", large).Info("upload")
+
+			assert.Less(t, buf.Len(), 200)
+			assert.Contains(t, buf.String(), "xxxxxxxxxxxxxxxx...(truncated)")
+		})
+	}
+}
+
+func TestTruncateValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		expected  string
+		truncated bool
+	}{
+		{name: "Short string", value: "short"},
+		{name: "Exact limit", value: "12345678"},
+		{name: "Long string", value: "123456789", expected: "12345678...(truncated)", truncated: true},
+		{name: "Multi-byte boundary", value: "1234567é", expected: "1234567...(truncated)", truncated: true},
+		{name: "Bytes", value: []byte("abcdefghij"), expected: "abcdefgh...(truncated)", truncated: true},
+		{name: "Number", value: 1234567890123},
+		{name: "Nested struct", value: map[string][]int{"ids": {1, 2, 3, 4}}, expected: `{"ids":[...(truncated)`, truncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncated, ok := truncateValue(tt.value, 8)
+			assert.Equal(t, tt.truncated, ok)
+			assert.Equal(t, tt.expected, truncated)
+		})
+	}
+}
+
+func TestMaxFieldValueBytesOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	value := strings.Repeat("y", 10000)
+	log.WithField("payload", value).Info("kept")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, value, entries[0].Fields["payload"])
+}
+
+func TestDisableHTMLEscape(t *testing.T) {
+	const url = "https://example.com/search?q=<beto>&page=2"
+
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+	log.Info(url)
+	assert.Contains(t, buf.String(), `\u003cbeto\u003e\u0026page`, "HTML is escaped by default")
+
+	buf.Reset()
+	log = New(Config{Level: "info", Format: "json", Output: &buf, DisableHTMLEscape: true})
+	log.WithField("referer", url).Info(url)
+
+	assert.NotContains(t, buf.String(), `\u0026`)
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"), "entries must stay on one line")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, url, entries[0].Message)
+	assert.Contains(t, buf.String(), `"message":"`+url+`"`)
+	assert.Contains(t, buf.String(), `"referer":"`+url+`"`)
+}
+
+func TestHTTPLogMiddlewareRequestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    interface{}
+		truncated   bool
+	}{
+		{
+			name:        "JSON with redaction",
+			contentType: "application/json",
+			body:        `{"user":"ana","Password":"hunter2","nested":{"token":"abc"}}`,
+			expected:    map[string]interface{}{"user": "ana", "Password": "***", "nested": map[string]interface{}{"token": "***"}},
+		},
+		{
+			name:        "Text",
+			contentType: "text/plain; charset=utf-8",
+			body:        "hello",
+			expected:    "hello",
+		},
+		{
+			name:        "Truncated text",
+			contentType: "text/plain",
+			body:        strings.Repeat("a", 80),
+			expected:    strings.Repeat("a", 64),
+			truncated:   true,
+		},
+		{
+			name:        "Truncated JSON is omitted",
+			contentType: "application/json",
+			body:        `{"data":"` + strings.Repeat("a", 80) + `"}`,
+			truncated:   true,
+		},
+		{
+			name:        "Binary is not captured",
+			contentType: "application/octet-stream",
+			body:        "\x00\x01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: "json", Output: &buf, RedactFields: []string{"password", "token"}})
+
+			var received string
+			handler := log.HTTPLogMiddlewareWithOptions(HTTPLogOptions{LogRequestBody: true, MaxBodyBytes: 64})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					data, err := io.ReadAll(r.Body)
+					require.NoError(t, err)
+					received = string(data)
+				}))
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.body, received, "the handler must still read the full body")
+
+			entries := decodeEntries(t, &buf)
+			require.Len(t, entries, 1)
+			assert.Equal(t, tt.expected, entries[0].Fields["request_body"])
+			if tt.truncated {
+				assert.Equal(t, true, entries[0].Fields["request_body_truncated"])
+			} else {
+				assert.NotContains(t, entries[0].Fields, "request_body_truncated")
+			}
+		})
+	}
+}
+
+func TestHTTPLogMiddlewareRequestBodyOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	handler := log.HTTPLogMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"user":"ana"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].Fields, "request_body")
+}
+
+func TestRedactFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf, RedactFields: []string{"password"}})
+
+	base := log.WithField("password", "hunter2")
+	base.WithField("user", "ana").Info("login")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "***", entries[0].Fields["password"])
+	assert.Equal(t, "ana", entries[0].Fields["user"])
+}
+
+func TestHTTPLogMiddlewareBytesWritten(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	handler := log.HTTPLogMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello ")
+		io.WriteString(w, "world")
+		w.(http.Flusher).Flush()
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	assert.True(t, rr.Flushed, "Flush must reach the underlying writer")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, float64(11), entries[0].Fields["bytes_written"])
+}
+
+func TestHTTPLogMiddlewareSuperfluousWriteHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		expectedStatus int
+		superfluous    bool
+	}{
+		{
+			name: "Single WriteHeader",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Second WriteHeader",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedStatus: http.StatusCreated,
+			superfluous:    true,
+		},
+		{
+			name: "WriteHeader after Write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "body")
+				w.WriteHeader(http.StatusNotFound)
+			},
+			expectedStatus: http.StatusOK,
+			superfluous:    true,
+		},
+		{
+			name: "Informational header before final status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusAccepted)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+			log.HTTPLogMiddleware()(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+			entries := decodeEntries(t, &buf)
+			require.Len(t, entries, 1)
+			assert.Equal(t, float64(tt.expectedStatus), entries[0].Fields["status_code"])
+			if tt.superfluous {
+				assert.Equal(t, true, entries[0].Fields["superfluous_writeheader"])
+			} else {
+				assert.NotContains(t, entries[0].Fields, "superfluous_writeheader")
+			}
+		})
+	}
+}
+
+func TestHTTPLogMiddlewareHijack(t *testing.T) {
+	log := New(Config{Level: "info", Format: "json", Output: io.Discard})
+
+	server := httptest.NewServer(log.HTTPLogMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hijacked", string(body))
+}
+
+func TestHTTPLogMiddlewareTotalLatency(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	handler := log.HTTPLogMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+
+	// The proxy received the request 100ms before it reached the server
+	received := time.Now().Add(-100 * time.Millisecond)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestStartHeader, fmt.Sprintf("t=%d", received.UnixMicro()))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	fields := entries[0].Fields
+
+	processing, err := time.ParseDuration(fields["duration"].(string))
+	require.NoError(t, err)
+
+	total, ok := fields["total_latency_ms"].(float64)
+	require.True(t, ok)
+	assert.Greater(t, total, milliseconds(processing))
+	assert.GreaterOrEqual(t, total, float64(100))
+	assert.GreaterOrEqual(t, fields["queue_time_ms"], float64(100))
+}
+
+func TestParseLevelStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected LogLevel
+		valid    bool
+	}{
+		{name: "Lower case", value: "debug", expected: DEBUG, valid: true},
+		{name: "Upper case", value: "ERROR", expected: ERROR, valid: true},
+		{name: "Alias", value: "warning", expected: WARN, valid: true},
+		{name: "Typo", value: "infoo"},
+		{name: "Empty", value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ParseLevelStrict(tt.value)
+			if !tt.valid {
+				require.ErrorIs(t, err, ErrInvalidLevel)
+				assert.Equal(t, `invalid log level "`+tt.value+`", valid levels are trace, debug, info, warn, warning, error, fatal`, err.Error())
+				assert.Equal(t, INFO, ParseLevel(tt.value), "the lenient parser falls back to INFO")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, level)
+			assert.Equal(t, tt.expected, ParseLevel(tt.value))
+		})
+	}
+}
+
+func TestParseFormatStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected LogFormat
+		valid    bool
+	}{
+		{name: "JSON", value: "json", expected: JSONFormat, valid: true},
+		{name: "Text", value: "Text", expected: TextFormat, valid: true},
+		{name: "Alias", value: "plain", expected: TextFormat, valid: true},
+		{name: "Logfmt", value: "logfmt", expected: LogfmtFormat, valid: true},
+		{name: "Invalid", value: "xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ParseFormatStrict(tt.value)
+			if !tt.valid {
+				require.ErrorIs(t, err, ErrInvalidFormat)
+				assert.Equal(t, `invalid log format "xml", valid formats are json, text, plain, logfmt`, err.Error())
+				assert.Equal(t, JSONFormat, parseLogFormat(tt.value), "the lenient parser falls back to JSON")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+}
+
+func TestSugaredKeysAndValues(t *testing.T) {
+	tests := []struct {
+		name           string
+		keysAndValues  []interface{}
+		expectedFields map[string]interface{}
+	}{
+		{name: "None", expectedFields: nil},
+		{name: "Pairs", keysAndValues: []interface{}{"user_id", "u1", "attempt", 2}, expectedFields: map[string]interface{}{"user_id": "u1", "attempt": float64(2)}},
+		{name: "Odd count", keysAndValues: []interface{}{"user_id", "u1", "dangling"}, expectedFields: map[string]interface{}{"user_id": "u1", BadKeyField: "dangling"}},
+		{name: "Single value", keysAndValues: []interface{}{42}, expectedFields: map[string]interface{}{BadKeyField: float64(42)}},
+		{name: "Non-string key", keysAndValues: []interface{}{7, "seven"}, expectedFields: map[string]interface{}{"7": "seven"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+			log.Infow("100% done for %s", tt.keysAndValues...)
+
+			entries := decodeEntries(t, &buf)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "100% done for %s", entries[0].Message, "the message is not a format string")
+			assert.Equal(t, tt.expectedFields, entries[0].Fields)
+		})
+	}
+}
+
+func TestSugaredLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	_, _, line, _ := runtime.Caller(0)
+	log.Debugw("hidden", "k", "v")
+	log.Infow("info", "k", "v")
+	log.Warnw("warn", "k", "v")
+	log.Errorw("error", "k", "v")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{"INFO", "WARN", "ERROR"}, []string{entries[0].Level, entries[1].Level, entries[2].Level})
+	assert.Equal(t, "v", entries[2].Fields["k"])
+	assert.Equal(t, fmt.Sprintf("logger_test.go:%d", line+4), entries[2].Caller, "the caller is the call site")
+}
+
+func TestErrorReturn(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+	original := errors.New("connection refused")
+
+	_, _, line, _ := runtime.Caller(0)
+	err := log.ErrorReturn(original, "loading user %d", 42)
+
+	assert.Same(t, original, err, "the same error is returned")
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "ERROR", entries[0].Level)
+	assert.Equal(t, "loading user 42", entries[0].Message)
+	assert.Equal(t, "connection refused", entries[0].Fields["error"])
+	assert.Equal(t, fmt.Sprintf("logger_test.go:%d", line+1), entries[0].Caller, "the caller is the call site")
+}
+
+func TestWrapError(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	_, _, line, _ := runtime.Caller(0)
+	err := log.WrapError(io.ErrUnexpectedEOF, "reading config 100%")
+
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.EqualError(t, err, "reading config 100%: unexpected EOF")
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "reading config 100%", entries[0].Message, "msg is not a format string")
+	assert.Equal(t, "unexpected EOF", entries[0].Fields["error"])
+	assert.Equal(t, fmt.Sprintf("logger_test.go:%d", line+1), entries[0].Caller)
+}
+
+func TestErrorReturnNil(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	assert.NoError(t, log.ErrorReturn(nil, "nothing"))
+	assert.NoError(t, log.WrapError(nil, "nothing"))
+	assert.Empty(t, buf.String())
+
+	// A disabled level still returns the error
+	log.SetLevel(FATAL)
+	assert.ErrorIs(t, log.WrapError(io.EOF, "quiet"), io.EOF)
+	assert.Empty(t, buf.String())
+}
+
+func TestParseRequestStart(t *testing.T) {
+	want := time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{name: "Seconds", value: "1704164645.678", ok: true},
+		{name: "Milliseconds", value: "1704164645678", ok: true},
+		{name: "Microseconds with prefix", value: "t=1704164645678000", ok: true},
+		{name: "Nanoseconds", value: "1704164645678000000", ok: true},
+		{name: "Empty", value: ""},
+		{name: "Garbage", value: "t=yesterday"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRequestStart(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.WithinDuration(t, want, got, time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestHTTPLogMiddlewareWithoutRequestStart(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	log.HTTPLogMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].Fields, "total_latency_ms")
+}
+
+func TestHTTPLogMiddlewareSlowThreshold(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     time.Duration
+		sleep         time.Duration
+		expectedLevel string
+		expectedSlow  interface{}
+	}{
+		{name: "Slow", threshold: 20 * time.Millisecond, sleep: 40 * time.Millisecond, expectedLevel: "WARN", expectedSlow: true},
+		{name: "Fast", threshold: time.Second, expectedLevel: "INFO"},
+		{name: "Disabled", sleep: 20 * time.Millisecond, expectedLevel: "INFO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+			handler := log.HTTPLogMiddlewareWithOptions(HTTPLogOptions{SlowThreshold: tt.threshold})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { time.Sleep(tt.sleep) }))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/report", nil))
+
+			entries := decodeEntries(t, &buf)
+			require.Len(t, entries, 1)
+			assert.Equal(t, tt.expectedLevel, entries[0].Level)
+			assert.Equal(t, tt.expectedSlow, entries[0].Fields["slow"])
+		})
+	}
+}
+
+func TestHTTPLogMiddlewareExcludePaths(t *testing.T) {
+	tests := []struct {
+		path   string
+		logged bool
+	}{
+		{path: "/health", logged: false},
+		{path: "/metrics", logged: false},
+		{path: "/metrics/go", logged: false},
+		{path: "/metricsz", logged: true},
+		{path: "/api/v1/status", logged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+			served := false
+			handler := log.HTTPLogMiddlewareWithOptions(HTTPLogOptions{ExcludePaths: []string{"/health", "/metrics/"}})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served = true }))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+
+			assert.True(t, served)
+			if tt.logged {
+				assert.Len(t, decodeEntries(t, &buf), 1)
+			} else {
+				assert.Empty(t, buf.String())
+			}
+		})
+	}
+}
+
+func TestNamed(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	httpLog := log.Named("http")
+	httpLog.Info("serving")
+	httpLog.Named("db").WithFields(map[string]interface{}{"query": "select"}).Info("querying")
+	log.Info("unnamed")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "http", entries[0].Logger)
+	assert.Equal(t, "http.db", entries[1].Logger)
+	assert.Equal(t, "select", entries[1].Fields["query"])
+	assert.Empty(t, entries[2].Logger, "Named must not modify the parent")
+	assert.NotContains(t, strings.Split(buf.String(), "\n")[2], `"logger"`)
+
+	buf.Reset()
+	log.SetFormat(TextFormat)
+	log.Named("worker").WithField("job", 7).Info("started")
+	assert.Contains(t, buf.String(), "[INFO] worker: started")
+}
+
+func TestColor(t *testing.T) {
+	tests := []struct {
+		name     string
+		color    string
+		level    func(*Logger)
+		expected string
+	}{
+		{name: "Info green", color: "always", level: func(l *Logger) { l.Info("m") }, expected: "\x1b[32m[INFO]\x1b[0m"},
+		{name: "Debug gray", color: "always", level: func(l *Logger) { l.Debug("m") }, expected: "\x1b[90m[DEBUG]\x1b[0m"},
+		{name: "Warn yellow", color: "always", level: func(l *Logger) { l.Warn("m") }, expected: "\x1b[33m[WARN]\x1b[0m"},
+		{name: "Error red", color: "always", level: func(l *Logger) { l.Error("m") }, expected: "\x1b[31m[ERROR]\x1b[0m"},
+		{name: "Never", color: "never", level: func(l *Logger) { l.Info("m") }, expected: "[INFO]"},
+		{name: "Auto without terminal", color: "auto", level: func(l *Logger) { l.Info("m") }, expected: "[INFO]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.level(New(Config{Level: "debug", Format: "text", Output: &buf, Color: tt.color}))
+			assert.Contains(t, buf.String(), tt.expected)
+			if tt.color != "always" {
+				assert.NotContains(t, buf.String(), "\x1b[")
+			}
+		})
+	}
+}
+
+func TestColorNeverAppliesToJSON(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf, Color: "always"})
+	log.Error("failed")
+
+	assert.NotContains(t, buf.String(), "\x1b[")
+	assert.Len(t, decodeEntries(t, &buf), 1)
+}
+
+func TestContextLoggingFunctions(t *testing.T) {
+	var buf bytes.Buffer
+	previous := GetGlobalLogger()
+	SetGlobalLogger(New(Config{Level: "debug", Format: "json", Output: &buf}))
+	defer SetGlobalLogger(previous)
+
+	ctx := context.WithValue(context.Background(), RequestIDKey, "req-1")
+	_, _, line, _ := runtime.Caller(0)
+	InfoCtx(ctx, "hello %s", "world")
+	ErrorCtx(ctx, "failed")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "hello world", entries[0].Message)
+	assert.Equal(t, "INFO", entries[0].Level)
+	assert.Equal(t, "req-1", entries[0].Fields["request_id"])
+	assert.Equal(t, "ERROR", entries[1].Level)
+
+	// The caller is the call site, not the wrapper
+	assert.Equal(t, fmt.Sprintf("logger_test.go:%d", line+1), entries[0].Caller)
+	assert.Equal(t, fmt.Sprintf("logger_test.go:%d", line+2), entries[1].Caller)
+}
+
+func TestIsLevelEnabled(t *testing.T) {
+	log := New(Config{Level: "warn", Output: io.Discard})
+
+	assert.False(t, log.IsLevelEnabled(DEBUG))
+	assert.False(t, log.IsLevelEnabled(INFO))
+	assert.True(t, log.IsLevelEnabled(WARN))
+	assert.True(t, log.IsLevelEnabled(ERROR))
+}
+
+func TestWithLazyField(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	calls := 0
+	lazy := log.WithLazyField("dump", func() interface{} {
+		calls++
+		return "expensive"
+	})
+
+	lazy.Debug("suppressed")
+	assert.Equal(t, 0, calls, "fn must not run for suppressed entries")
+
+	lazy.Info("first")
+	lazy.WithField("extra", 1).Info("second")
+	assert.Equal(t, 2, calls, "fn runs once per emitted entry")
+
+	lazy.WithField("dump", "eager").Info("overridden")
+	assert.Equal(t, 2, calls, "a later WithField replaces the lazy field")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "expensive", entries[0].Fields["dump"])
+	assert.Equal(t, "expensive", entries[1].Fields["dump"])
+	assert.Equal(t, "eager", entries[2].Fields["dump"])
+
+	buf.Reset()
+	log.Info("parent")
+	assert.NotContains(t, buf.String(), "dump", "the parent logger is unchanged")
+}
+
+func TestFieldOrderIsDeterministic(t *testing.T) {
+	fields := map[string]interface{}{"zeta": 1, "alpha": 2, "mike": 3, "bravo": 4, "yankee": 5}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{format: "text", expected: "{alpha=2, bravo=4, mike=3, yankee=5, zeta=1}"},
+		{format: "json", expected: `"fields":{"alpha":2,"bravo":4,"mike":3,"yankee":5,"zeta":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				var buf bytes.Buffer
+				log := New(Config{Level: "info", Format: tt.format, Output: &buf, Color: "never"})
+				log.WithFields(fields).Info("ordered")
+				assert.Contains(t, buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "logfmt", Output: &buf})
+
+	log.WithFields(map[string]interface{}{
+		"user":    "alice",
+		"query":   "a=b",
+		"path":    "/search results",
+		"said":    `she said "hi"`,
+		"lines":   "one\ntwo",
+		"count":   3,
+		"empty":   "",
+		"bad key": true,
+	}).Info("request done")
+
+	line := strings.TrimSuffix(buf.String(), "\n")
+	prefix, fields, ok := strings.Cut(line, ` msg="request done" `)
+	require.True(t, ok, line)
+	assert.Regexp(t, `^ts=\S+ level=INFO$`, prefix)
+	assert.Equal(t, `bad_key=true count=3 empty= lines="one\ntwo" path="/search results" query="a=b" said="she said \"hi\"" user=alice`, fields)
+}
+
+func TestLogfmtFormatCaller(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "logfmt", Output: &buf})
+
+	log.WithField("attempt", 2).Error("dial failed")
+
+	assert.Regexp(t, `^ts=\S+ level=ERROR caller=logger_test\.go:\d+ msg="dial failed" attempt=2\n$`, buf.String())
+}
+
+func TestHTTPLogMiddlewareAccessFormats(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{format: AccessFormatCommon, expected: `192.0.2.1 - ana [DATE] "GET /search?q=a%20b HTTP/1.1" 201 5` + "\n"},
+		{format: AccessFormatCombined, expected: `192.0.2.1 - ana [DATE] "GET /search?q=a%20b HTTP/1.1" 201 5 "https://example.com/" "test \"agent\""` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+			handler := log.HTTPLogMiddlewareWithOptions(HTTPLogOptions{AccessFormat: tt.format})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusCreated)
+					io.WriteString(w, "hello")
+				}))
+
+			req := httptest.NewRequest("GET", "/search?q=a%20b", nil)
+			req.SetBasicAuth("ana", "secret")
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", `test "agent"`)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			line := buf.String()
+			start := strings.Index(line, "[") + 1
+			end := strings.Index(line, "]")
+			_, err := time.Parse(clfTimeFormat, line[start:end])
+			require.NoError(t, err)
+
+			assert.Equal(t, strings.Replace(tt.expected, "DATE", line[start:end], 1), line)
+		})
+	}
+}
+
+func TestFormatAccessLineDefaults(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	line := formatAccessLine(AccessFormatCombined, req, nil, time.Now(), 204, 0)
+
+	assert.True(t, strings.HasPrefix(line, "192.0.2.1 - - ["))
+	assert.True(t, strings.HasSuffix(line, `"POST / HTTP/1.1" 204 - "" ""`))
+}
+
+// syncWriter serializes writes so that concurrent tests only race on the
+// logger itself
+type syncWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestConcurrentWithFieldAndLog(t *testing.T) {
+	out := &syncWriter{}
+	base := New(Config{
+		Level:         "info",
+		Format:        "json",
+		Output:        out,
+		DefaultFields: map[string]interface{}{"service": "beto"},
+		RedactFields:  []string{"password"},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				base.Info("base")
+				derived := base.WithField("worker", i).WithField("password", "secret")
+				derived.WithFields(map[string]interface{}{"iteration": j}).Info("derived")
+				derived.WithLazyField("lazy", func() interface{} { return j }).Info("lazy")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries := decodeEntries(t, &out.buf)
+	assert.Len(t, entries, 8*50*3)
+	for _, entry := range entries {
+		assert.Equal(t, "beto", entry.Fields["service"])
+		if entry.Message != "base" {
+			assert.Equal(t, "***", entry.Fields["password"])
+		} else {
+			assert.NotContains(t, entry.Fields, "worker", "derived fields must not leak into the base logger")
+		}
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestWriteFailureFallback(t *testing.T) {
+	sinkErr := errors.New("disk full")
+
+	var fallback bytes.Buffer
+	var handled []error
+	log := New(Config{
+		Level:          "info",
+		Format:         "json",
+		Output:         failingWriter{err: sinkErr},
+		FallbackOutput: &fallback,
+		ErrorHandler:   func(err error) { handled = append(handled, err) },
+	})
+
+	log.WithField("k", "v").Info("important")
+
+	assert.Equal(t, []error{sinkErr}, handled)
+	lines := strings.Split(strings.TrimSpace(fallback.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "logger: write to log output failed: disk full", lines[0])
+	assert.Contains(t, lines[1], `"message":"important"`)
+}
+
+func TestWriteFailureFallbackAlsoFails(t *testing.T) {
+	calls := 0
+	log := New(Config{
+		Level:          "info",
+		Output:         failingWriter{err: errors.New("primary")},
+		FallbackOutput: failingWriter{err: errors.New("fallback")},
+		ErrorHandler:   func(error) { calls++ },
+	})
+
+	log.Info("dropped")
+	assert.Equal(t, 1, calls, "a failing fallback must not recurse")
+}
+
+func TestNewTee(t *testing.T) {
+	sinkErr := errors.New("disk full")
+
+	var stdout, file, fallback bytes.Buffer
+	var handled []error
+	log := NewTee(Config{
+		Level:          "info",
+		Format:         "json",
+		Output:         &stdout,
+		FallbackOutput: &fallback,
+		ErrorHandler:   func(err error) { handled = append(handled, err) },
+	}, failingWriter{err: sinkErr}, &file)
+
+	log.WithField("k", "v").Info("everywhere")
+
+	assert.Equal(t, stdout.String(), file.String(), "every destination gets the same line")
+	entries := decodeEntries(t, &stdout)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "everywhere", entries[0].Message)
+
+	require.Len(t, handled, 1)
+	assert.ErrorIs(t, handled[0], sinkErr)
+	assert.Contains(t, handled[0].Error(), "tee output 1")
+	assert.Contains(t, fallback.String(), `"message":"everywhere"`)
+}
+
+func TestNewTeeWithoutOutput(t *testing.T) {
+	var a, b bytes.Buffer
+	log := NewTee(Config{Level: "info", Format: "text"}, &a, &b)
+
+	log.Info("twice")
+
+	assert.Contains(t, a.String(), "twice")
+	assert.Equal(t, a.String(), b.String())
+}
+
+func TestAuditLogger(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAudit(&buf)
+
+	// The audit stream ignores the level of the global logger
+	original := GetGlobalLogger()
+	SetGlobalLogger(New(Config{Level: "fatal", Output: io.Discard}))
+	defer SetGlobalLogger(original)
+
+	require.NoError(t, audit.Event("admin", "login", "session", nil))
+	require.NoError(t, audit.Event("admin", "update", "rate_limit", map[string]interface{}{"requests_per_window": 10}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var events []AuditEvent
+	for _, line := range lines {
+		var event AuditEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+
+	assert.Equal(t, uint64(1), events[0].Seq)
+	assert.Equal(t, uint64(2), events[1].Seq)
+	assert.Equal(t, "login", events[0].Action)
+	assert.NotContains(t, lines[0], `"meta"`)
+	assert.Equal(t, AuditEvent{
+		Seq:       2,
+		Timestamp: events[1].Timestamp,
+		Actor:     "admin",
+		Action:    "update",
+		Target:    "rate_limit",
+		Meta:      map[string]interface{}{"requests_per_window": float64(10)},
+	}, events[1])
+
+	_, err := time.Parse(time.RFC3339Nano, events[0].Timestamp)
+	assert.NoError(t, err)
+}
+
+func TestAuditLoggerConcurrent(t *testing.T) {
+	out := &syncWriter{}
+	audit := NewAudit(out)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			audit.Event("worker", "ping", "server", nil)
+		}()
+	}
+	wg.Wait()
+
+	for i, line := range strings.Split(strings.TrimSpace(out.buf.String()), "\n") {
+		var event AuditEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		assert.Equal(t, uint64(i+1), event.Seq, "events are written in sequence order")
+	}
+}
+
+func TestAuditLoggerWriteFailure(t *testing.T) {
+	sinkErr := errors.New("disk full")
+	audit := NewAudit(failingWriter{err: sinkErr})
+
+	err := audit.Event("admin", "login", "session", nil)
+	assert.ErrorIs(t, err, sinkErr)
+
+	err = audit.Event("admin", "login", "session", map[string]interface{}{"bad": func() {}})
+	assert.ErrorContains(t, err, "encoding audit event")
+}
+
+func TestDropWhenContextDone(t *testing.T) {
+	tests := []struct {
+		name     string
+		drop     bool
+		cancel   bool
+		expected []string
+	}{
+		{name: "Enabled and done", drop: true, cancel: true, expected: []string{"ERROR"}},
+		{name: "Enabled and live", drop: true, expected: []string{"DEBUG", "INFO", "WARN", "ERROR"}},
+		{name: "Disabled and done", cancel: true, expected: []string{"DEBUG", "INFO", "WARN", "ERROR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "debug", Format: "json", Output: &buf, DropWhenContextDone: tt.drop})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			// Loggers derived from a context-bound logger keep the context
+			reqLog := log.WithContext(ctx).WithField("k", "v")
+			reqLog.Debug("debug")
+			reqLog.Info("info")
+			reqLog.Warn("warn")
+			reqLog.Error("error")
+
+			var levels []string
+			for _, entry := range decodeEntries(t, &buf) {
+				levels = append(levels, entry.Level)
+			}
+			assert.Equal(t, tt.expected, levels)
+
+			buf.Reset()
+			log.Info("no context")
+			assert.Contains(t, buf.String(), "no context", "loggers without a context are unaffected")
+		})
+	}
+}
+
+func TestFatalExitCode(t *testing.T) {
+	var code int
+	exit = func(c int) { code = c }
+	t.Cleanup(func() { exit = os.Exit })
+
+	tests := []struct {
+		name     string
+		config   int
+		fatal    func(l *Logger)
+		expected int
+	}{
+		{name: "Default", fatal: func(l *Logger) { l.Fatal("boom") }, expected: 1},
+		{name: "Configured", config: 3, fatal: func(l *Logger) { l.Fatal("boom") }, expected: 3},
+		{name: "Derived", config: 3, fatal: func(l *Logger) { l.WithField("k", "v").Fatal("boom") }, expected: 3},
+		{name: "Explicit", config: 3, fatal: func(l *Logger) { l.FatalWithCode(75, "boom") }, expected: 75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(Config{Level: "info", Format: "json", Output: &buf, FatalExitCode: tt.config})
+
+			code = -1
+			tt.fatal(log)
+
+			assert.Equal(t, tt.expected, code)
+			assert.Contains(t, buf.String(), `"level":"FATAL"`)
+			assert.Contains(t, buf.String(), `"message":"boom"`)
+		})
+	}
+}
+
+func TestIncludeHostAndPID(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf, IncludeHost: true, IncludePID: true})
+	log.WithField("hostname", "spoofed").WithField("k", "v").Info("stamped")
+
+	var entry LogEntry
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, hostname, entry.Fields["hostname"])
+	assert.Equal(t, float64(os.Getpid()), entry.Fields["pid"])
+	assert.Equal(t, "v", entry.Fields["k"])
+
+	buf.Reset()
+	log.SetFormat(TextFormat)
+	log.Info("stamped")
+	assert.Contains(t, buf.String(), "hostname="+hostname)
+	assert.Contains(t, buf.String(), fmt.Sprintf("pid=%d", os.Getpid()))
+}
+
+func TestHostAndPIDOmittedByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+	log.Info("plain")
+
+	assert.NotContains(t, buf.String(), "hostname")
+	assert.NotContains(t, buf.String(), "pid")
+}
+
+func TestDedupCollapsesByMessageAndFields(t *testing.T) {
+	out := &syncWriter{}
+	log := New(Config{
+		Level:       "info",
+		Format:      "json",
+		Output:      out,
+		DedupWindow: time.Hour,
+		DedupFields: []string{"user_id", "path"},
+	})
+
+	for i := 0; i < 3; i++ {
+		log.WithFields(map[string]interface{}{"user_id": "u1", "path": "/a", "attempt": i}).Error("lookup failed")
+	}
+	log.WithFields(map[string]interface{}{"user_id": "u2", "path": "/a"}).Error("lookup failed")
+	log.WithFields(map[string]interface{}{"user_id": "u1", "path": "/a"}).Warn("lookup failed")
+	log.Info("other")
+
+	out.mu.Lock()
+	assert.Empty(t, out.buf.String(), "entries are held until the window closes")
+	out.mu.Unlock()
+
+	require.NoError(t, log.Close())
+	entries := decodeEntries(t, &out.buf)
+	require.Len(t, entries, 4)
+
+	assert.Equal(t, "u1", entries[0].Fields["user_id"])
+	assert.Equal(t, float64(0), entries[0].Fields["attempt"], "the first entry is kept")
+	assert.Equal(t, float64(3), entries[0].Fields[OccurrencesField])
+	assert.Equal(t, "u2", entries[1].Fields["user_id"])
+	assert.Equal(t, float64(1), entries[1].Fields[OccurrencesField])
+	assert.Equal(t, "WARN", entries[2].Level)
+	assert.Equal(t, "other", entries[3].Message)
+
+	// After Close entries are written immediately
+	out.buf.Reset()
+	log.Info("late")
+	assert.Contains(t, out.buf.String(), `"message":"late"`)
+	assert.NotContains(t, out.buf.String(), OccurrencesField)
+}
+
+func TestDedupFlushesWhenWindowCloses(t *testing.T) {
+	out := &syncWriter{}
+	log := New(Config{Level: "info", Format: "json", Output: out, DedupWindow: 20 * time.Millisecond})
+	defer log.Close()
+
+	log.Error("burst")
+	log.Error("burst")
+
+	require.Eventually(t, func() bool {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return strings.Contains(out.buf.String(), `"occurrences":2`)
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestDedupFlushesBeforeFatal(t *testing.T) {
+	exit = func(int) {}
+	t.Cleanup(func() { exit = os.Exit })
+
+	out := &syncWriter{}
+	log := New(Config{Level: "info", Format: "json", Output: out, DedupWindow: time.Hour})
+
+	log.Error("burst")
+	log.Error("burst")
+	log.Fatal("giving up")
+
+	entries := decodeEntries(t, &out.buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "burst", entries[0].Message)
+	assert.Equal(t, float64(2), entries[0].Fields[OccurrencesField])
+	assert.Equal(t, "FATAL", entries[1].Level, "the fatal entry is written last")
+}
+
+// panicOnceWriter panics on its first write and then behaves like syncWriter
+type panicOnceWriter struct {
+	syncWriter
+	panicked bool
+}
+
+func (w *panicOnceWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if !w.panicked {
+		w.panicked = true
+		w.mu.Unlock()
+		panic("sink exploded")
+	}
+	w.mu.Unlock()
+	return w.syncWriter.Write(p)
+}
+
+func TestDedupFlusherRecoversFromPanic(t *testing.T) {
+	out := &panicOnceWriter{}
+	fallback := &syncWriter{}
+	log := New(Config{Level: "info", Format: "json", Output: out, FallbackOutput: fallback, DedupWindow: 20 * time.Millisecond})
+	defer log.Close()
+
+	log.Error("lost")
+
+	// The first flush panics; wait for it before logging again
+	require.Eventually(t, func() bool {
+		fallback.mu.Lock()
+		defer fallback.mu.Unlock()
+		return fallback.buf.Len() > 0
+	}, time.Second, 5*time.Millisecond)
+
+	fallback.mu.Lock()
+	entries := decodeEntries(t, &fallback.buf)
+	fallback.mu.Unlock()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "ERROR", entries[0].Level)
+	assert.Equal(t, "sink exploded", entries[0].Fields["panic"])
+	assert.NotEmpty(t, entries[0].Fields["stack"])
+
+	log.Error("delivered")
+	require.Eventually(t, func() bool {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return strings.Contains(out.buf.String(), `"message":"delivered"`)
+	}, time.Second, 5*time.Millisecond, "the flusher keeps running after a panic")
+}
+
+// recordingHook records the entries it fires for, failing with err or
+// panicking with panicValue if set
+type recordingHook struct {
+	levels     []LogLevel
+	entries    []LogEntry
+	err        error
+	panicValue interface{}
+}
+
+func (h *recordingHook) Levels() []LogLevel { return h.levels }
+
+func (h *recordingHook) Fire(entry LogEntry) error {
+	if h.panicValue != nil {
+		panic(h.panicValue)
+	}
+	h.entries = append(h.entries, entry)
+	return h.err
+}
+
+func TestHookLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "debug", Format: "json", Output: &buf})
+
+	hook := &recordingHook{levels: []LogLevel{ERROR, FATAL}}
+	derived := log.WithField("request_id", "abc")
+	log.AddHook(hook)
+
+	log.Debug("debug")
+	log.Info("info")
+	log.Warn("warn")
+	log.Error("failed %d times", 3)
+	derived.Error("from derived logger")
+
+	require.Len(t, hook.entries, 2)
+	assert.Equal(t, "ERROR", hook.entries[0].Level)
+	assert.Equal(t, "failed 3 times", hook.entries[0].Message)
+	assert.NotEmpty(t, hook.entries[0].Caller)
+	assert.Equal(t, "abc", hook.entries[1].Fields["request_id"], "loggers derived before AddHook share the hook")
+	assert.Len(t, decodeEntries(t, &buf), 5, "hooks do not affect output")
+}
+
+func TestHooksFireForDeduplicatedEntries(t *testing.T) {
+	out := &syncWriter{}
+	log := New(Config{Level: "info", Format: "json", Output: out, DedupWindow: time.Hour})
+	hook := &recordingHook{levels: []LogLevel{ERROR}}
+	log.AddHook(hook)
+
+	for i := 0; i < 3; i++ {
+		log.Error("lookup failed")
+	}
+	log.Error("other failure")
+	assert.Empty(t, hook.entries, "hooks fire when the entry is written")
+
+	require.NoError(t, log.Close())
+	require.Len(t, hook.entries, 2)
+	assert.Equal(t, "lookup failed", hook.entries[0].Message)
+	assert.Equal(t, 3, hook.entries[0].Fields[OccurrencesField])
+	assert.Equal(t, "other failure", hook.entries[1].Message)
+}
+
+func TestHookFailuresAreReported(t *testing.T) {
+	var buf, fallback bytes.Buffer
+	var handled []error
+	log := New(Config{
+		Level:          "info",
+		Format:         "json",
+		Output:         &buf,
+		FallbackOutput: &fallback,
+		ErrorHandler:   func(err error) { handled = append(handled, err) },
+	})
+
+	failing := &recordingHook{levels: []LogLevel{WARN}, err: errors.New("sentry unavailable")}
+	panicking := &recordingHook{levels: []LogLevel{WARN}, panicValue: "hook exploded"}
+	working := &recordingHook{levels: []LogLevel{WARN}}
+	log.AddHook(failing)
+	log.AddHook(panicking)
+	log.AddHook(working)
+
+	assert.NotPanics(t, func() { log.Warn("disk almost full") })
+
+	assert.Len(t, working.entries, 1, "later hooks still fire")
+	require.Len(t, handled, 2)
+	assert.EqualError(t, handled[0], "sentry unavailable")
+	assert.Contains(t, handled[1].Error(), "hook exploded")
+	assert.Contains(t, fallback.String(), "logger: hook failed: sentry unavailable")
+	assert.Len(t, decodeEntries(t, &buf), 1)
+}
+
+func TestDedupOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	log.Info("same")
+	log.Info("same")
+
+	assert.Len(t, decodeEntries(t, &buf), 2)
+	assert.NotContains(t, buf.String(), OccurrencesField)
+	assert.NoError(t, log.Close())
+}
+
+func TestTraceLevel(t *testing.T) {
+	assert.Equal(t, TRACE, parseLogLevel("trace"))
+	assert.Equal(t, "TRACE", TRACE.String())
+	assert.Less(t, TRACE, DEBUG)
+
+	var buf bytes.Buffer
+	log := New(Config{Level: "debug", Format: "json", Output: &buf})
+	log.Trace("hidden")
+	assert.Empty(t, buf.String(), "TRACE is below DEBUG")
+
+	log = New(Config{Level: "trace", Format: "json", Output: &buf})
+	log.Trace("shown %d", 1)
+	log.Debug("also shown")
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "TRACE", entries[0].Level)
+	assert.Equal(t, "shown 1", entries[0].Message)
+	assert.NotEmpty(t, entries[0].Caller, "caller info is included at TRACE")
+	assert.NotEmpty(t, entries[1].Caller)
+}
+
+func TestTimer(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "debug", Format: "json", Output: &buf})
+
+	stop := log.Timer("load users")
+	time.Sleep(5 * time.Millisecond)
+	stop()
+
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "DEBUG", entries[0].Level)
+	assert.Equal(t, "load users", entries[0].Fields["operation"])
+	assert.GreaterOrEqual(t, entries[0].Fields["duration_ms"], float64(5))
+	assert.Contains(t, entries[0].Message, "load users took ")
+	assert.Contains(t, entries[0].Caller, "logger_test.go")
+}
+
+func TestDisabledLevelDoesNotAllocate(t *testing.T) {
+	log := New(Config{Level: "info", Format: "json", Output: io.Discard}).
+		WithFields(map[string]interface{}{"service": "beto"})
+	ctx := context.WithValue(context.Background(), RequestIDKey, "req-123")
+
+	original := GetGlobalLogger()
+	SetGlobalLogger(log)
+	defer SetGlobalLogger(original)
+
+	tests := []struct {
+		name string
+		call func()
+	}{
+		{name: "Debug", call: func() { log.Debug("cache miss") }},
+		{name: "Debug with constant args", call: func() { log.Debug("cache miss for %s after %d ms", "users", 12) }},
+		{name: "Trace", call: func() { log.Trace("entering handler") }},
+		{name: "Global Debug", call: func() { Debug("cache miss") }},
+		{name: "DebugCtx", call: func() { DebugCtx(ctx, "cache miss") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Zero(t, testing.AllocsPerRun(100, tt.call))
+		})
+	}
+}
+
+// BenchmarkDisabledDebug measures a Debug call on a logger at INFO. Run
+// with -benchmem: it should report 0 allocs/op.
+func BenchmarkDisabledDebug(b *testing.B) {
+	log := New(Config{Level: "info", Format: "json", Output: io.Discard}).
+		WithFields(map[string]interface{}{"service": "beto"})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Debug("cache miss for %s after %d ms", "users", 12)
+	}
+}
+
+func ExampleLogger_Timer() {
+	log := New(Config{Level: "debug", Format: "json"})
+
+	loadUsers := func() {
+		defer log.Timer("load users")()
+		// ... query the database
+	}
+	loadUsers()
+}
+
+func TestNewSplit(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log := NewSplit(Config{Level: "debug", Output: &stdout, ErrorOutput: &stderr})
+
+	log.Info("started")
+	log.Error("failed")
+	log.Warn("slow")
+	log.Debug("details")
+
+	out := decodeEntries(t, &stdout)
+	require.Len(t, out, 2)
+	assert.Equal(t, "started", out[0].Message)
+	assert.Equal(t, "details", out[1].Message)
+
+	errs := decodeEntries(t, &stderr)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "ERROR", errs[0].Level)
+	assert.Equal(t, "failed", errs[0].Message)
+	assert.Equal(t, "slow", errs[1].Message)
+}
+
+// point is a custom fmt.Stringer for the field coercion tests
+type point struct{ X, Y int }
+
+func (p *point) String() string { return fmt.Sprintf("(%d, %d)", p.X, p.Y) }
+
+func TestFieldCoercion(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	fields := map[string]interface{}{
+		"error":    errors.New("connection refused"),
+		"point":    &point{X: 1, Y: 2},
+		"at":       at,
+		"nil_ptr":  (*point)(nil),
+		"duration": 1500 * time.Millisecond,
+		"count":    3,
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := New(Config{Level: "info", Format: "json", Output: &buf})
+		log.WithFields(fields).Info("coerced")
+
+		entries := decodeEntries(t, &buf)
+		require.Len(t, entries, 1)
+		got := entries[0].Fields
+		assert.Equal(t, "connection refused", got["error"], "errors must not encode as {}")
+		assert.Equal(t, "(1, 2)", got["point"])
+		assert.Equal(t, "2024-03-01T12:30:00Z", got["at"])
+		assert.Equal(t, "<nil>", got["nil_ptr"])
+		assert.Equal(t, "1.5s", got["duration"])
+		assert.Equal(t, float64(3), got["count"], "other values are left alone")
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := New(Config{Level: "info", Format: "text", Color: "never", Output: &buf})
+		log.WithFields(fields).Info("coerced")
+
+		line := buf.String()
+		assert.Contains(t, line, "error=connection refused")
+		assert.Contains(t, line, "point=(1, 2)")
+		assert.Contains(t, line, "at=2024-03-01T12:30:00Z")
+	})
+
+	t.Run("logfmt", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := New(Config{Level: "info", Format: "logfmt", Output: &buf})
+		log.WithFields(fields).Info("coerced")
+
+		line := buf.String()
+		assert.Contains(t, line, `error="connection refused"`)
+		assert.Contains(t, line, `at=2024-03-01T12:30:00Z`)
+	})
+}
+
+func TestFieldCoercionKeepsHookValues(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+	hook := &recordingHook{levels: []LogLevel{INFO}}
+	log.AddHook(hook)
+
+	cause := errors.New("boom")
+	log.WithField("error", cause).Info("failed")
+
+	require.Len(t, hook.entries, 1)
+	assert.Same(t, cause, hook.entries[0].Fields["error"], "hooks receive the original value")
+	assert.Contains(t, buf.String(), `"error":"boom"`)
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestHTTPLogMiddlewareDoesNotReadAheadOfHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(Config{Level: "info", Format: "json", Output: &buf})
+
+	// The handler rejects the request without reading the body, as the
+	// body limit middleware does for an oversized Content-Length
+	handler := log.HTTPLogMiddlewareWithOptions(HTTPLogOptions{LogRequestBody: true})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}))
+
+	body := &countingReader{Reader: strings.NewReader(`{"user":"ana"}`)}
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Zero(t, body.n, "the body must stay unread")
+	entries := decodeEntries(t, &buf)
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].Fields, "request_body")
+}
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// NewSplit creates a logger that writes DEBUG and INFO entries to
+// config.Output and WARN, ERROR and FATAL entries to config.ErrorOutput,
+// which default to os.Stdout and os.Stderr, so that container platforms
+// classify them correctly. Both destinations get the same format, JSON
+// unless config.Format says otherwise. Access log lines count as INFO.
+func NewSplit(config Config) *Logger {
+	if config.Format == "" {
+		config.Format = "json"
+	}
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	if config.ErrorOutput == nil {
+		config.ErrorOutput = os.Stderr
+	}
+	config.Output = &splitWriter{low: config.Output, high: config.ErrorOutput, threshold: WARN}
+	return New(config)
+}
+
+// levelWriter is implemented by outputs that route lines by level
+type levelWriter interface {
+	WriteLevel(level LogLevel, p []byte) (int, error)
+}
+
+// splitWriter sends lines at threshold or above to high and the rest to low
+type splitWriter struct {
+	low       io.Writer
+	high      io.Writer
+	threshold LogLevel
+}
+
+// Write writes lines of unknown level to low
+func (s *splitWriter) Write(p []byte) (int, error) {
+	return s.low.Write(p)
+}
+
+// WriteLevel writes p to the destination for level
+func (s *splitWriter) WriteLevel(level LogLevel, p []byte) (int, error) {
+	if level >= s.threshold {
+		return s.high.Write(p)
+	}
+	return s.low.Write(p)
+}
+
+// Sync flushes both destinations if they support it
+func (s *splitWriter) Sync() error {
+	var errs []error
+	for _, w := range []io.Writer{s.low, s.high} {
+		if sw, ok := w.(interface{ Sync() error }); ok {
+			errs = append(errs, sw.Sync())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NewTee creates a logger that writes every entry, in the single format
+// set by config, to config.Output, if set, and to each of writers. For
+// example, JSON can go to stdout for a log collector and to a local file.
+//
+// Unlike io.MultiWriter, a failed write to one destination does not stop
+// the others. The failures are reported to config.ErrorHandler and the
+// entry is also written to FallbackOutput, as for any failed write.
+func NewTee(config Config, writers ...io.Writer) *Logger {
+	if config.Output != nil {
+		writers = append([]io.Writer{config.Output}, writers...)
+	}
+	if len(writers) > 0 {
+		config.Output = &teeWriter{writers: writers}
+	}
+	return New(config)
+}
+
+// teeWriter duplicates writes to several writers
+type teeWriter struct {
+	writers []io.Writer
+}
+
+// Write writes p to every writer and returns the failures joined together
+func (t *teeWriter) Write(p []byte) (int, error) {
+	var errs []error
+	for i, w := range t.writers {
+		n, err := w.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tee output %d: %w", i, err))
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
+
+// Sync flushes the writers that support it, so that Fatal does not lose
+// the final entry
+func (t *teeWriter) Sync() error {
+	var errs []error
+	for _, w := range t.writers {
+		if s, ok := w.(interface{ Sync() error }); ok {
+			errs = append(errs, s.Sync())
+		}
+	}
+	return errors.Join(errs...)
+}
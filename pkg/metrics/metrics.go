@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the latency histogram upper bounds in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// labels identifies a series of the request metrics
+type labels struct {
+	method string
+	path   string
+	status string
+}
+
+// histogram accumulates observations into cumulative buckets. exemplars
+// holds the latest traced observation per bucket, with +Inf last.
+type histogram struct {
+	counts    []uint64
+	count     uint64
+	sum       float64
+	exemplars []*exemplar
+}
+
+// exemplar links an observation to the trace that produced it
+type exemplar struct {
+	traceID string
+	value   float64
+	time    time.Time
+}
+
+// HTTPMetrics records HTTP request metrics and exposes them in the
+// Prometheus text exposition format
+type HTTPMetrics struct {
+	namespace string
+	buckets   []float64
+	inFlight  int64
+
+	mu        sync.Mutex
+	requests  map[labels]uint64
+	durations map[labels]*histogram
+}
+
+// NewHTTPMetrics creates an empty set of metrics whose names are prefixed
+// with namespace. Nil buckets means DefaultBuckets.
+func NewHTTPMetrics(namespace string, buckets []float64) *HTTPMetrics {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &HTTPMetrics{
+		namespace: namespace,
+		buckets:   buckets,
+		requests:  make(map[labels]uint64),
+		durations: make(map[labels]*histogram),
+	}
+}
+
+// Start marks a request as in flight. Call the returned function when it ends.
+func (m *HTTPMetrics) Start() func() {
+	atomic.AddInt64(&m.inFlight, 1)
+	return func() { atomic.AddInt64(&m.inFlight, -1) }
+}
+
+// Observe records a completed request. The path should be a route template
+// rather than the raw URL path to keep the number of series bounded.
+func (m *HTTPMetrics) Observe(method, path string, status int, seconds float64) {
+	m.ObserveWithTrace(method, path, status, seconds, "")
+}
+
+// ObserveWithTrace records a completed request like Observe. A non-empty
+// traceID is kept as an exemplar on the latency bucket the request fell
+// into and is exposed in the OpenMetrics format.
+func (m *HTTPMetrics) ObserveWithTrace(method, path string, status int, seconds float64, traceID string) {
+	key := labels{method: method, path: path, status: strconv.Itoa(status)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[key]++
+
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{
+			counts:    make([]uint64, len(m.buckets)),
+			exemplars: make([]*exemplar, len(m.buckets)+1),
+		}
+		m.durations[key] = h
+	}
+	bucket := len(m.buckets)
+	for i := len(m.buckets) - 1; i >= 0; i-- {
+		if seconds <= m.buckets[i] {
+			h.counts[i]++
+			bucket = i
+		}
+	}
+	h.count++
+	h.sum += seconds
+
+	if traceID != "" {
+		h.exemplars[bucket] = &exemplar{traceID: traceID, value: seconds, time: time.Now()}
+	}
+}
+
+// WriteTo writes all metrics to w in the Prometheus text format
+func (m *HTTPMetrics) WriteTo(w io.Writer) (int64, error) {
+	return m.write(w, false)
+}
+
+// WriteOpenMetrics writes all metrics to w in the OpenMetrics text format,
+// including trace exemplars on the latency buckets
+func (m *HTTPMetrics) WriteOpenMetrics(w io.Writer) (int64, error) {
+	return m.write(w, true)
+}
+
+func (m *HTTPMetrics) write(w io.Writer, openMetrics bool) (int64, error) {
+	var b strings.Builder
+
+	requests := m.namespace + "_http_requests_total"
+	inFlight := m.namespace + "_http_requests_in_flight"
+	duration := m.namespace + "_http_request_duration_seconds"
+
+	// OpenMetrics names counter families without the _total suffix
+	requestsFamily := requests
+	if openMetrics {
+		requestsFamily = strings.TrimSuffix(requests, "_total")
+	}
+
+	m.mu.Lock()
+	keys := make([]labels, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	fmt.Fprintf(&b, "# HELP %s Total number of HTTP requests.\n", requestsFamily)
+	fmt.Fprintf(&b, "# TYPE %s counter\n", requestsFamily)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s{%s} %d\n", requests, key.format(), m.requests[key])
+	}
+
+	fmt.Fprintf(&b, "# HELP %s Number of HTTP requests currently being served.\n", inFlight)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", inFlight)
+	fmt.Fprintf(&b, "%s %d\n", inFlight, atomic.LoadInt64(&m.inFlight))
+
+	fmt.Fprintf(&b, "# HELP %s HTTP request latency in seconds.\n", duration)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", duration)
+	for _, key := range keys {
+		h := m.durations[key]
+		for i, bound := range m.buckets {
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d", duration, key.format(), formatFloat(bound), h.counts[i])
+			writeExemplar(&b, h.exemplars[i], openMetrics)
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d", duration, key.format(), h.count)
+		writeExemplar(&b, h.exemplars[len(m.buckets)], openMetrics)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", duration, key.format(), formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", duration, key.format(), h.count)
+	}
+	m.mu.Unlock()
+
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// writeExemplar ends a bucket line, appending the exemplar if there is one
+// and the format supports it
+func writeExemplar(b *strings.Builder, e *exemplar, openMetrics bool) {
+	if openMetrics && e != nil {
+		fmt.Fprintf(b, " # {trace_id=\"%s\"} %s %s", escapeLabel(e.traceID), formatFloat(e.value),
+			strconv.FormatFloat(float64(e.time.UnixNano())/1e9, 'f', 3, 64))
+	}
+	b.WriteString("\n")
+}
+
+// Handler serves the metrics in the Prometheus text format, or in the
+// OpenMetrics format with exemplars when the scraper accepts it
+func (m *HTTPMetrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			m.WriteOpenMetrics(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		m.WriteTo(w)
+	})
+}
+
+// format renders the labels as name="value" pairs
+func (l labels) format() string {
+	return fmt.Sprintf(`method="%s",path="%s",status="%s"`,
+		escapeLabel(l.method), escapeLabel(l.path), escapeLabel(l.status))
+}
+
+// escapeLabel escapes a label value as required by the text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	m := NewHTTPMetrics("test", []float64{0.1, 1})
+
+	done := m.Start()
+	m.Observe("GET", "/users/{id}", 200, 0.05)
+	m.Observe("GET", "/users/{id}", 200, 0.5)
+	m.Observe("POST", "/users", 201, 2)
+
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE test_http_requests_total counter\n")
+	assert.Contains(t, out, `test_http_requests_total{method="GET",path="/users/{id}",status="200"} 2`)
+	assert.Contains(t, out, `test_http_requests_total{method="POST",path="/users",status="201"} 1`)
+	assert.Contains(t, out, "test_http_requests_in_flight 1\n")
+	assert.Contains(t, out, `test_http_request_duration_seconds_bucket{method="GET",path="/users/{id}",status="200",le="0.1"} 1`)
+	assert.Contains(t, out, `test_http_request_duration_seconds_bucket{method="GET",path="/users/{id}",status="200",le="1"} 2`)
+	assert.Contains(t, out, `test_http_request_duration_seconds_bucket{method="GET",path="/users/{id}",status="200",le="+Inf"} 2`)
+	assert.Contains(t, out, `test_http_request_duration_seconds_bucket{method="POST",path="/users",status="201",le="1"} 0`)
+	assert.Contains(t, out, `test_http_request_duration_seconds_sum{method="GET",path="/users/{id}",status="200"} 0.55`)
+	assert.Contains(t, out, `test_http_request_duration_seconds_count{method="POST",path="/users",status="201"} 1`)
+
+	done()
+	buf.Reset()
+	_, err = m.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "test_http_requests_in_flight 0\n")
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"))
+}
+
+func TestOpenMetricsExemplars(t *testing.T) {
+	m := NewHTTPMetrics("test", []float64{0.1, 1})
+	m.ObserveWithTrace("GET", "/", 200, 0.5, "abc123")
+	m.ObserveWithTrace("GET", "/", 200, 5, "def456")
+	m.Observe("GET", "/", 200, 0.05)
+
+	var buf bytes.Buffer
+	_, err := m.WriteOpenMetrics(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE test_http_requests counter\n")
+	assert.Contains(t, out, `test_http_request_duration_seconds_bucket{method="GET",path="/",status="200",le="0.1"} 1`+"\n")
+	assert.Contains(t, out, `test_http_request_duration_seconds_bucket{method="GET",path="/",status="200",le="1"} 2 # {trace_id="abc123"} 0.5 `)
+	assert.Contains(t, out, `test_http_request_duration_seconds_bucket{method="GET",path="/",status="200",le="+Inf"} 3 # {trace_id="def456"} 5 `)
+	assert.True(t, strings.HasSuffix(out, "# EOF\n"))
+
+	buf.Reset()
+	_, err = m.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.NotContains(t, buf.String(), "trace_id")
+}
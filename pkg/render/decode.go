@@ -0,0 +1,85 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// DefaultMaxBodyBytes caps the request bodies read by DecodeJSON. A
+// smaller limit set by middleware with http.MaxBytesReader still applies.
+const DefaultMaxBodyBytes = 1 << 20
+
+// DecodeJSON decodes the JSON request body into dst. Fields that dst does
+// not have, trailing data after the first value and bodies larger than
+// DefaultMaxBodyBytes are rejected. On failure the error response has
+// already been written, a 400 naming the offending field when possible or
+// a 413 for oversized bodies, and the returned error describes the problem
+// for logging; the handler should simply return.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, DefaultMaxBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil {
+		if dec.Decode(&struct{}{}) != io.EOF {
+			err = errMultipleValues
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	status, msg := decodeErrorResponse(err)
+	if status == http.StatusInternalServerError {
+		logger.WithField("error", err.Error()).Error("Decoding JSON request body failed")
+	}
+	Error(w, status, msg)
+	return err
+}
+
+// errMultipleValues is reported when the body holds more than one JSON value
+var errMultipleValues = errors.New("request body must contain a single JSON value")
+
+// decodeErrorResponse translates a DecodeJSON error into the status and
+// message sent to the client
+func decodeErrorResponse(err error) (int, string) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	var invalidErr *json.InvalidUnmarshalError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return http.StatusBadRequest, fmt.Sprintf("request body contains malformed JSON at position %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "request body contains malformed JSON"
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return http.StatusBadRequest, fmt.Sprintf("field %q must be of type %s", typeErr.Field, typeErr.Type)
+		}
+		return http.StatusBadRequest, fmt.Sprintf("request body must not be a JSON %s", typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return http.StatusBadRequest, fmt.Sprintf("request body contains unknown field %s", field)
+	case errors.Is(err, io.EOF):
+		return http.StatusBadRequest, "request body must not be empty"
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit)
+	case errors.Is(err, errMultipleValues):
+		return http.StatusBadRequest, err.Error()
+	case errors.As(err, &invalidErr):
+		// dst is not a non-nil pointer, a bug in the handler
+		return http.StatusInternalServerError, "internal server error"
+	default:
+		return http.StatusBadRequest, "request body could not be read"
+	}
+}
@@ -0,0 +1,32 @@
+// Package render writes JSON HTTP responses
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// JSON writes v as JSON with the given status. If v cannot be encoded, the
+// error is logged and a 500 with a generic error body is written instead.
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("Encoding JSON response failed")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"error":"internal server error"}`+"\n")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// Error writes {"error": msg} with the given status
+func Error(w http.ResponseWriter, status int, msg string) {
+	JSON(w, status, map[string]string{"error": msg})
+}
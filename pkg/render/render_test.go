@@ -0,0 +1,125 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		value        interface{}
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "Struct", status: http.StatusCreated, value: struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}{ID: 1, Name: "beto"}, expectedCode: http.StatusCreated, expectedBody: `{"id":1,"name":"beto"}`},
+		{name: "Quotes are escaped", status: http.StatusOK, value: map[string]string{"message": `say "hi"`}, expectedCode: http.StatusOK, expectedBody: `{"message":"say \"hi\""}`},
+		{name: "Unencodable", status: http.StatusOK, value: map[string]interface{}{"fn": func() {}}, expectedCode: http.StatusInternalServerError, expectedBody: `{"error":"internal server error"}`},
+	}
+
+	original := logger.GetGlobalLogger()
+	logger.SetGlobalLogger(logger.New(logger.Config{Output: io.Discard}))
+	defer logger.SetGlobalLogger(original)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			JSON(rr, tt.status, tt.value)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Error(rr, http.StatusUnauthorized, `token "abc" expired`)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error": "token \"abc\" expired"}`, rr.Body.String())
+}
+
+func TestDecodeJSON(t *testing.T) {
+	type payload struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+		Tags  struct {
+			Primary string `json:"primary"`
+		} `json:"tags"`
+	}
+
+	tests := []struct {
+		name          string
+		body          string
+		expectedCode  int
+		expectedError string
+	}{
+		{name: "Unknown field", body: `{"name": "beto", "colour": "blue"}`, expectedCode: http.StatusBadRequest, expectedError: `request body contains unknown field "colour"`},
+		{name: "Wrong type", body: `{"count": "three"}`, expectedCode: http.StatusBadRequest, expectedError: `field "count" must be of type int`},
+		{name: "Wrong type in nested field", body: `{"tags": {"primary": 1}}`, expectedCode: http.StatusBadRequest, expectedError: `field "tags.primary" must be of type string`},
+		{name: "Wrong top-level type", body: `[1, 2]`, expectedCode: http.StatusBadRequest, expectedError: "request body must not be a JSON array"},
+		{name: "Empty body", body: ``, expectedCode: http.StatusBadRequest, expectedError: "request body must not be empty"},
+		{name: "Syntax error", body: `{"name": beto}`, expectedCode: http.StatusBadRequest, expectedError: "request body contains malformed JSON at position 10"},
+		{name: "Truncated", body: `{"name": "beto"`, expectedCode: http.StatusBadRequest, expectedError: "request body contains malformed JSON"},
+		{name: "Multiple values", body: `{"name": "a"}{"name": "b"}`, expectedCode: http.StatusBadRequest, expectedError: "request body must contain a single JSON value"},
+		{name: "Too large", body: `{"name": "` + strings.Repeat("x", DefaultMaxBodyBytes) + `"}`, expectedCode: http.StatusRequestEntityTooLarge, expectedError: fmt.Sprintf("request body exceeds %d bytes", DefaultMaxBodyBytes)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			var dst payload
+			err := DecodeJSON(rr, req, &dst)
+			require.Error(t, err)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			assert.JSONEq(t, fmt.Sprintf(`{"error": %q}`, tt.expectedError), rr.Body.String())
+		})
+	}
+}
+
+func TestDecodeJSONSuccess(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "beto", "count": 3}`+"\n"))
+	rr := httptest.NewRecorder()
+
+	var dst struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	require.NoError(t, DecodeJSON(rr, req, &dst))
+
+	assert.Equal(t, "beto", dst.Name)
+	assert.Equal(t, 3, dst.Count)
+	assert.Zero(t, rr.Body.Len(), "nothing is written on success")
+}
+
+func TestDecodeJSONInvalidDestination(t *testing.T) {
+	original := logger.GetGlobalLogger()
+	logger.SetGlobalLogger(logger.New(logger.Config{Output: io.Discard}))
+	defer logger.SetGlobalLogger(original)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	rr := httptest.NewRecorder()
+
+	var dst struct{}
+	require.Error(t, DecodeJSON(rr, req, dst))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -0,0 +1,93 @@
+// Package sse writes Server-Sent Events responses
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidField is returned for an event name or ID containing a line
+// break, which would corrupt the stream
+var ErrInvalidField = errors.New("sse: event name and ID must not contain line breaks")
+
+// Event is a single Server-Sent Event. Only Data is required.
+type Event struct {
+	// ID sets the client's last event ID, sent back in the Last-Event-ID
+	// header when it reconnects
+	ID string
+	// Name is the event type; empty means "message"
+	Name string
+	// Data may span several lines
+	Data string
+	// Retry tells the client how long to wait before reconnecting. Zero
+	// leaves the client's default.
+	Retry time.Duration
+}
+
+// Stream writes events to a response, flushing after each one so that
+// they reach the client immediately
+type Stream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewStream starts an event stream on w: it sets the Content-Type and
+// Cache-Control headers, writes a 200 status and flushes it. It fails if w
+// cannot be flushed, as events would then sit in a buffer.
+func NewStream(w http.ResponseWriter) (*Stream, error) {
+	rc := http.NewResponseController(w)
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Stops nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return nil, fmt.Errorf("sse: flushing response: %w", err)
+	}
+	return &Stream{w: w, rc: rc}, nil
+}
+
+// Send writes event and flushes it
+func (s *Stream) Send(event Event) error {
+	if strings.ContainsAny(event.ID, "\r\n") || strings.ContainsAny(event.Name, "\r\n") {
+		return ErrInvalidField
+	}
+
+	var b strings.Builder
+	if event.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", event.ID)
+	}
+	if event.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", event.Name)
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	data := strings.ReplaceAll(event.Data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteByte('\n')
+
+	if _, err := s.w.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// SendJSON sends v encoded as JSON as the data of an event called name
+func (s *Stream) SendJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("sse: encoding event data: %w", err)
+	}
+	return s.Send(Event{Name: name, Data: string(data)})
+}
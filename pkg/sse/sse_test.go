@@ -0,0 +1,80 @@
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStream(t *testing.T) {
+	rr := httptest.NewRecorder()
+	_, err := NewStream(rr)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", rr.Header().Get("Cache-Control"))
+	assert.True(t, rr.Flushed, "headers are flushed right away")
+}
+
+// unflushableWriter hides the recorder's Flush method
+type unflushableWriter struct {
+	http.ResponseWriter
+}
+
+func TestNewStreamRequiresFlusher(t *testing.T) {
+	_, err := NewStream(unflushableWriter{httptest.NewRecorder()})
+	assert.ErrorIs(t, err, http.ErrNotSupported)
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    Event
+		expected string
+	}{
+		{name: "Data only", event: Event{Data: "hello"}, expected: "data: hello\n\n"},
+		{
+			name:     "All fields",
+			event:    Event{ID: "7", Name: "status", Data: `{"ok":true}`, Retry: 3 * time.Second},
+			expected: "id: 7\nevent: status\nretry: 3000\ndata: {\"ok\":true}\n\n",
+		},
+		{name: "Multiline data", event: Event{Data: "one\ntwo\r\nthree"}, expected: "data: one\ndata: two\ndata: three\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			stream, err := NewStream(rr)
+			require.NoError(t, err)
+
+			require.NoError(t, stream.Send(tt.event))
+			assert.Equal(t, tt.expected, rr.Body.String())
+		})
+	}
+}
+
+func TestSendRejectsLineBreaks(t *testing.T) {
+	rr := httptest.NewRecorder()
+	stream, err := NewStream(rr)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, stream.Send(Event{Name: "status\ndata: injected", Data: "x"}), ErrInvalidField)
+	assert.ErrorIs(t, stream.Send(Event{ID: "1\r", Data: "x"}), ErrInvalidField)
+	assert.Empty(t, rr.Body.String())
+}
+
+func TestSendJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	stream, err := NewStream(rr)
+	require.NoError(t, err)
+
+	require.NoError(t, stream.SendJSON("tick", map[string]int{"n": 1}))
+	assert.Equal(t, "event: tick\ndata: {\"n\":1}\n\n", rr.Body.String())
+
+	assert.Error(t, stream.SendJSON("tick", func() {}))
+}
@@ -0,0 +1,50 @@
+// Package store opens connections to the backing services described by the
+// configuration. The drivers live here so that pkg/config does not depend
+// on them.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	// Registers the "pgx" database/sql driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+// Connection pool limits for the database
+const (
+	dbMaxOpenConns    = 25
+	dbMaxIdleConns    = 5
+	dbConnMaxLifetime = 30 * time.Minute
+	dbConnMaxIdleTime = 5 * time.Minute
+)
+
+// OpenDatabase opens a pooled PostgreSQL connection using cfg and pings it
+// to verify connectivity
+func OpenDatabase(ctx context.Context, cfg config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", cfg.DatabaseURL())
+	if err != nil {
+		return nil, fmt.Errorf("opening postgres %s: %w", databaseAddr(cfg), err)
+	}
+
+	db.SetMaxOpenConns(dbMaxOpenConns)
+	db.SetMaxIdleConns(dbMaxIdleConns)
+	db.SetConnMaxLifetime(dbConnMaxLifetime)
+	db.SetConnMaxIdleTime(dbConnMaxIdleTime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to postgres %s: %w", databaseAddr(cfg), err)
+	}
+	return db, nil
+}
+
+// databaseAddr describes the database for error messages without the
+// password
+func databaseAddr(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf("%s@%s:%s/%s", cfg.User, cfg.Host, cfg.Port, cfg.DBName)
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+// Connection pool limits and timeouts for Redis
+const (
+	redisPoolSize     = 20
+	redisMinIdleConns = 2
+	redisDialTimeout  = 5 * time.Second
+)
+
+// OpenRedis creates a pooled Redis client using cfg and pings it to verify
+// connectivity
+func OpenRedis(ctx context.Context, cfg config.RedisConfig) (*redis.Client, error) {
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     redisPoolSize,
+		MinIdleConns: redisMinIdleConns,
+		DialTimeout:  redisDialTimeout,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to redis %s/%d: %w", addr, cfg.DB, err)
+	}
+	return client, nil
+}
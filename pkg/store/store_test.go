@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+// closedPort returns a local port with nothing listening on it
+func closedPort(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+	return port
+}
+
+func TestOpenDatabaseUnreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	port := closedPort(t)
+	_, err := OpenDatabase(ctx, config.DatabaseConfig{
+		Host: "127.0.0.1", Port: port, User: "beto", Password: "db-password", DBName: "beto_db", SSLMode: "disable",
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connecting to postgres beto@127.0.0.1:"+port+"/beto_db")
+	assert.NotContains(t, err.Error(), "db-password")
+}
+
+func TestOpenRedisUnreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	port := closedPort(t)
+	_, err := OpenRedis(ctx, config.RedisConfig{Host: "127.0.0.1", Port: port, DB: 2})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connecting to redis 127.0.0.1:"+port+"/2")
+}
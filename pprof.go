@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"net/http/pprof"
+)
+
+// errProfilingInProduction is returned by EnableProfiling in production
+// unless PROFILING_ALLOW_PRODUCTION is set
+var errProfilingInProduction = errors.New("profiling is disabled in production; set PROFILING_ALLOW_PRODUCTION to override")
+
+// EnableProfiling registers the net/http/pprof handlers under /debug/pprof/.
+// Profiles expose internals of the running process, so this is never done
+// by default and is refused in production unless explicitly allowed.
+func (a *App) EnableProfiling() error {
+	if a.Config.IsProduction() && !a.Config.Server.AllowProfilingInProduction {
+		return errProfilingInProduction
+	}
+
+	debug := a.Group("/debug/pprof")
+	debug.Handle("GET", "/", pprof.Index)
+	debug.Handle("GET", "/cmdline", pprof.Cmdline)
+	debug.Handle("GET", "/profile", pprof.Profile)
+	debug.Handle("GET", "/symbol", pprof.Symbol)
+	debug.Handle("POST", "/symbol", pprof.Symbol)
+	debug.Handle("GET", "/trace", pprof.Trace)
+	// Named profiles such as heap and goroutine are served by Index
+	debug.Handle("GET", "/{profile}", pprof.Index)
+
+	a.Logger.WithField("environment", a.Config.Environment).Warn("Profiling endpoints enabled at /debug/pprof/")
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestEnableProfiling(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	serve := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve("/debug/pprof/"), "profiling must be off by default")
+
+	require.NoError(t, app.EnableProfiling())
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap", "/debug/pprof/goroutine"} {
+		assert.Equal(t, http.StatusOK, serve(path), path)
+	}
+}
+
+func TestEnableProfilingInProduction(t *testing.T) {
+	cfg := config.Default()
+	cfg.Environment = "production"
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+
+	assert.ErrorIs(t, app.EnableProfiling(), errProfilingInProduction)
+
+	req := httptest.NewRequest("GET", "/debug/pprof/", nil)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	cfg.Server.AllowProfilingInProduction = true
+	assert.NoError(t, app.EnableProfiling())
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// rateLimiter is a fixed-window request limiter keyed by client
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	clients   map[string]*clientWindow
+	lastSweep time.Time
+}
+
+// clientWindow counts a client's requests in the current window
+type clientWindow struct {
+	start time.Time
+	count int
+}
+
+// newRateLimiter creates a limiter allowing limit requests per window.
+// A limit of zero or less disables limiting.
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		window:    window,
+		clients:   make(map[string]*clientWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow records a request from key and reports whether it is within the
+// limit. When it is not, it also returns how long until the window resets.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.sweep(now)
+
+	client, ok := l.clients[key]
+	if !ok || now.Sub(client.start) >= l.window {
+		client = &clientWindow{start: now}
+		l.clients[key] = client
+	}
+
+	if client.count >= l.limit {
+		return false, client.start.Add(l.window).Sub(now)
+	}
+	client.count++
+	return true, 0
+}
+
+// set changes the limit and window. Counts in the current windows are
+// kept, so a tightened limit takes effect immediately.
+func (l *rateLimiter) set(limit int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.window = window
+}
+
+// sweep drops expired client windows at most once per window. The caller
+// must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	for key, client := range l.clients {
+		if now.Sub(client.start) >= l.window {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimitMiddleware rejects clients exceeding the rate limit with 429
+func (a *App) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := a.limiter.allow(ClientIP(r)); !ok {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+			render.Error(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remoteHost returns the host part of the request's remote address
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// SetRateLimit changes the live rate limit. It is safe to call while the
+// server is handling requests. A limit of zero or less disables limiting.
+func (a *App) SetRateLimit(requestsPerWindow int, window time.Duration) {
+	a.limiter.set(requestsPerWindow, window)
+	a.Logger.WithFields(map[string]interface{}{
+		"requests_per_window": requestsPerWindow,
+		"window":              window.String(),
+	}).Info("Rate limit updated")
+}
+
+// rateLimitAdminHandler updates the live rate limit from a JSON body such as
+// {"requests_per_window": 10, "window": "1m"}. The new limit is recorded in
+// a.Config so that /admin/config shows it.
+func (a *App) rateLimitAdminHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RequestsPerWindow int    `json:"requests_per_window"`
+		Window            string `json:"window"`
+	}
+	if err := render.DecodeJSON(w, r, &body); err != nil {
+		return
+	}
+
+	window, err := time.ParseDuration(body.Window)
+	if err != nil || window <= 0 {
+		render.Error(w, http.StatusBadRequest, `window must be a positive duration such as "1m"`)
+		return
+	}
+
+	a.SetRateLimit(body.RequestsPerWindow, window)
+
+	a.configMu.Lock()
+	a.Config.RateLimit.Enabled = body.RequestsPerWindow > 0
+	a.Config.RateLimit.RequestsPerWindow = body.RequestsPerWindow
+	a.Config.RateLimit.WindowDuration = window
+	a.configMu.Unlock()
+
+	a.auditEvent(auditActorAdmin, auditActionUpdate, "rate_limit", map[string]interface{}{
+		"requests_per_window": body.RequestsPerWindow,
+		"window":              window.String(),
+		"client_ip":           ClientIP(r),
+	})
+
+	render.JSON(w, http.StatusOK, map[string]interface{}{
+		"requests_per_window": body.RequestsPerWindow,
+		"window":              window.String(),
+	})
+}
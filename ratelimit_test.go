@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func newRateLimitedApp(t *testing.T, limit int) *App {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.RateLimit = config.RateLimitConfig{Enabled: true, RequestsPerWindow: limit, WindowDuration: time.Minute}
+	cfg.Server.AdminToken = "admin-token"
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Audit.SetOutput(io.Discard)
+	return app
+}
+
+// countAllowed sends n requests from one client and returns how many succeeded
+func countAllowed(t *testing.T, app *App, n int) int {
+	t.Helper()
+
+	allowed := 0
+	for i := 0; i < n; i++ {
+		req, err := http.NewRequest("GET", "/health", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = "192.0.2.1:1234"
+
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		if rr.Code == http.StatusOK {
+			allowed++
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+			assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+		}
+	}
+	return allowed
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app := newRateLimitedApp(t, 3)
+	assert.Equal(t, 3, countAllowed(t, app, 5))
+
+	// Other clients have their own window
+	req, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.2:1234"
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRateLimitDisabledByDefault(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+	assert.Equal(t, 200, countAllowed(t, app, 200))
+}
+
+func TestSetRateLimit(t *testing.T) {
+	app := newRateLimitedApp(t, 10)
+	assert.Equal(t, 2, countAllowed(t, app, 2))
+
+	// Tightening the limit applies to the current window
+	app.SetRateLimit(3, time.Minute)
+	assert.Equal(t, 1, countAllowed(t, app, 5))
+
+	// Loosening it lets the client continue
+	app.SetRateLimit(6, time.Minute)
+	assert.Equal(t, 3, countAllowed(t, app, 5))
+}
+
+func TestRateLimitAdminEndpoint(t *testing.T) {
+	app := newRateLimitedApp(t, 10)
+
+	tests := []struct {
+		name           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "Missing token",
+			body:           `{"requests_per_window": 1, "window": "1m"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Wrong token",
+			token:          "guess",
+			body:           `{"requests_per_window": 1, "window": "1m"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Invalid window",
+			token:          "admin-token",
+			body:           `{"requests_per_window": 1, "window": "soon"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Valid update",
+			token:          "admin-token",
+			body:           `{"requests_per_window": 1, "window": "1m"}`,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("PUT", "/admin/rate-limit", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.RemoteAddr = "198.51.100.1:1234"
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+
+	assert.Equal(t, 1, countAllowed(t, app, 3))
+}
+
+func TestRateLimitAdminUpdateShownInConfig(t *testing.T) {
+	app := newRateLimitedApp(t, 10)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("PUT", "/admin/rate-limit", `{"requests_per_window": 3, "window": "30s"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serve("GET", "/admin/config", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var shown config.Config
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &shown))
+	assert.True(t, shown.RateLimit.Enabled)
+	assert.Equal(t, 3, shown.RateLimit.RequestsPerWindow)
+	assert.Equal(t, 30*time.Second, shown.RateLimit.WindowDuration)
+}
+
+func TestAdminRoutesDisabledWithoutToken(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	req, err := http.NewRequest("PUT", "/admin/rate-limit", strings.NewReader(`{}`))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
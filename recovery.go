@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// recoveryMiddleware turns a panic in any later middleware or handler into
+// a 500 response and logs it with the stack trace. setupRoutes installs it
+// before all other middleware so that it is always the outermost layer.
+//
+// http.ErrAbortHandler is re-panicked, as net/http uses it to abort the
+// response deliberately.
+func (a *App) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			a.Logger.WithFields(map[string]interface{}{
+				"panic":  fmt.Sprint(err),
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"stack":  string(debug.Stack()),
+			}).Error("Recovered from panic in HTTP handler")
+
+			render.Error(w, http.StatusInternalServerError, "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryWithMiddlewareAddedLater(t *testing.T) {
+	app := NewApp()
+	var buf bytes.Buffer
+	app.Logger.SetOutput(&buf)
+
+	var order []string
+	tag := func(name string) mux.MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	app.Use(tag("first"), tag("second"))
+	app.Handle("GET", "/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	req, err := http.NewRequest("GET", "/panic", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error": "internal server error"}`, rr.Body.String())
+	assert.Equal(t, []string{"first", "second"}, order)
+	assert.Contains(t, buf.String(), "Recovered from panic in HTTP handler")
+	assert.Contains(t, buf.String(), `"panic":"boom"`)
+}
+
+func TestHandlerRecoversOutsideMiddlewareChain(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(&bytes.Buffer{})
+	// A not found handler set on Router directly bypasses the chain
+	app.Router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("fallback boom")
+	})
+
+	req, err := http.NewRequest("GET", "/missing", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{"error": "internal server error"}`, rr.Body.String())
+}
+
+func TestRecoveryCatchesPanickingMiddleware(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(&bytes.Buffer{})
+	app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("middleware boom")
+		})
+	})
+
+	req, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestRecoveryRepanicsAbortHandler(t *testing.T) {
+	app := NewApp()
+	app.Handle("GET", "/abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	req, err := http.NewRequest("GET", "/abort", nil)
+	require.NoError(t, err)
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		app.Router.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
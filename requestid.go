@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request IDs so that clients cannot
+// bloat every log entry of a request
+const maxRequestIDLength = 128
+
+// IDGenerator creates request IDs
+type IDGenerator interface {
+	NewID() string
+}
+
+// uuidV7Generator creates version 7 UUIDs: a millisecond timestamp followed
+// by 74 bits from crypto/rand, so IDs sort by creation time and collisions
+// are practically impossible even across instances
+type uuidV7Generator struct{}
+
+// NewID returns a new UUID in the canonical 36 character form
+func (uuidV7Generator) NewID() string {
+	var uuid [16]byte
+	binary.BigEndian.PutUint64(uuid[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(uuid[6:])
+	uuid[6] = uuid[6]&0x0f | 0x70 // version 7
+	uuid[8] = uuid[8]&0x3f | 0x80 // RFC 9562 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], uuid[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], uuid[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], uuid[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], uuid[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], uuid[10:])
+	return string(buf[:])
+}
+
+// requestIDMiddleware gives every request an ID, taken from the
+// X-Request-ID header when the client sent a usable one and otherwise
+// created with the app's IDGenerator. The ID is echoed in the response
+// header, stored in the request context for logger.WithContext and added
+// to the access log entry. The context also carries the app logger with
+// the request_id field for logger.FromRequest.
+func (a *App) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = a.idGen.NewID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		logger.AddAccessLogField(r.Context(), "request_id", id)
+
+		ctx := context.WithValue(r.Context(), logger.RequestIDKey, id)
+		ctx = logger.NewContext(ctx, a.Logger.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether an incoming ID is short and consists of
+// printable ASCII, so it is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// counterIDGenerator returns req-1, req-2, ... for deterministic tests
+type counterIDGenerator struct{ n int }
+
+func (g *counterIDGenerator) NewID() string {
+	g.n++
+	return fmt.Sprintf("req-%d", g.n)
+}
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		incoming   string
+		expectedID string
+	}{
+		{name: "Generated", expectedID: "req-1"},
+		{name: "Incoming", incoming: "upstream-42", expectedID: "upstream-42"},
+		{name: "Incoming with spaces", incoming: "a b", expectedID: "req-1"},
+		{name: "Incoming too long", incoming: strings.Repeat("x", maxRequestIDLength+1), expectedID: "req-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp()
+			var buf bytes.Buffer
+			app.Logger.SetOutput(&buf)
+			app.idGen = &counterIDGenerator{}
+
+			var seen interface{}
+			app.Handle("GET", "/whoami", func(w http.ResponseWriter, r *http.Request) {
+				seen = r.Context().Value(logger.RequestIDKey)
+			})
+
+			req, err := http.NewRequest("GET", "/whoami", nil)
+			require.NoError(t, err)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedID, rr.Header().Get(RequestIDHeader))
+			assert.Equal(t, tt.expectedID, seen)
+
+			var entry struct {
+				Fields map[string]interface{} `json:"fields"`
+			}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, tt.expectedID, entry.Fields["request_id"], "the access log includes the ID")
+		})
+	}
+}
+
+func TestHandlerLogsShareRequestID(t *testing.T) {
+	app := NewApp()
+	var buf bytes.Buffer
+	app.Logger.SetOutput(&buf)
+	app.idGen = &counterIDGenerator{}
+
+	app.Handle("GET", "/work", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromRequest(r).Info("doing work")
+	})
+
+	req, err := http.NewRequest("GET", "/work", nil)
+	require.NoError(t, err)
+	app.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var entries [2]struct {
+		Message string                 `json:"message"`
+		Fields  map[string]interface{} `json:"fields"`
+	}
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+	}
+	assert.Equal(t, "doing work", entries[0].Message)
+	assert.Equal(t, "HTTP request", entries[1].Message)
+	assert.Equal(t, "req-1", entries[0].Fields["request_id"])
+	assert.Equal(t, entries[0].Fields["request_id"], entries[1].Fields["request_id"])
+}
+
+func TestUUIDV7Generator(t *testing.T) {
+	var gen uuidV7Generator
+
+	seen := make(map[string]bool)
+	previous := ""
+	for i := 0; i < 10000; i++ {
+		id := gen.NewID()
+		require.Regexp(t, uuidV7Pattern, id)
+		require.False(t, seen[id], "duplicate ID %s", id)
+		seen[id] = true
+
+		// The leading timestamp keeps IDs from different milliseconds ordered
+		assert.GreaterOrEqual(t, id[:13], previous)
+		previous = id[:13]
+	}
+}
+
+func BenchmarkUUIDV7Generator(b *testing.B) {
+	var gen IDGenerator = uuidV7Generator{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		gen.NewID()
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeXML  = "application/xml"
+)
+
+// respond writes payload with the given status, encoded as JSON or XML
+// depending on the request's Accept header. JSON is used when the header is
+// missing or accepts anything. When none of the accepted types can be
+// produced, a 406 Not Acceptable is written instead.
+//
+// Payloads must be encodable by both encoding/json and encoding/xml, which
+// in practice means a struct with json and xml tags rather than a map.
+func respond(w http.ResponseWriter, r *http.Request, status int, payload interface{}) {
+	mediaType, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		render.Error(w, http.StatusNotAcceptable, "not acceptable")
+		return
+	}
+
+	if mediaType == mediaTypeJSON {
+		render.JSON(w, status, payload)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(payload)
+}
+
+// negotiate picks the response media type for an Accept header, preferring
+// the highest quality value and JSON on ties. It returns false when the
+// header rules out every supported type.
+func negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return mediaTypeJSON, true
+	}
+
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		var candidate string
+		switch mediaType {
+		case "*/*", "application/*", mediaTypeJSON:
+			candidate = mediaTypeJSON
+		case mediaTypeXML, "text/xml":
+			candidate = mediaTypeXML
+		default:
+			continue
+		}
+
+		if q > bestQ || (q == bestQ && candidate == mediaTypeJSON) {
+			best, bestQ = candidate, q
+		}
+	}
+
+	// A q of 0 marks a type as not acceptable
+	if bestQ <= 0 {
+		return "", false
+	}
+	return best, true
+}
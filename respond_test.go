@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRespondJSON(t *testing.T) {
+	app := NewApp()
+	req, err := http.NewRequest("GET", "/api/v1/status", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var response statusResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "v1", response.API)
+	assert.Equal(t, "running", response.Status)
+}
+
+func TestRespondXML(t *testing.T) {
+	app := NewApp()
+	req, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/xml")
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "<health><status>healthy</status>")
+
+	var response healthResponse
+	require.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "healthy", response.Status)
+	assert.NotEmpty(t, response.Timestamp)
+}
+
+func TestRespondNotAcceptable(t *testing.T) {
+	app := NewApp()
+	req, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/html")
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{name: "Missing", accept: "", expected: "application/json", ok: true},
+		{name: "Any", accept: "*/*", expected: "application/json", ok: true},
+		{name: "JSON", accept: "application/json", expected: "application/json", ok: true},
+		{name: "XML", accept: "application/xml", expected: "application/xml", ok: true},
+		{name: "Text XML", accept: "text/xml", expected: "application/xml", ok: true},
+		{name: "Quality", accept: "application/json;q=0.5, application/xml", expected: "application/xml", ok: true},
+		{name: "Browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expected: "application/xml", ok: true},
+		{name: "Unsupported", accept: "text/html", ok: false},
+		{name: "Refused", accept: "application/json;q=0", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaType, ok := negotiate(tt.accept)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, mediaType)
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// routeCache memoizes introspection of registered routes so that
+// per-request lookups, such as the path template used to label metrics,
+// are a single map read regardless of how many routes exist, and Routes
+// does not walk the router on every call. Templates are keyed by route and
+// a route's template never changes once registered, so only the route list
+// is discarded by reset when a route is registered.
+type routeCache struct {
+	mu        sync.RWMutex
+	templates map[*mux.Route]string
+	infos     []RouteInfo
+	infosOK   bool
+}
+
+func newRouteCache() *routeCache {
+	return &routeCache{templates: make(map[*mux.Route]string)}
+}
+
+// template returns the path template of route, or "" for a nil route
+func (c *routeCache) template(route *mux.Route) string {
+	if route == nil {
+		return ""
+	}
+
+	c.mu.RLock()
+	template, ok := c.templates[route]
+	c.mu.RUnlock()
+	if ok {
+		return template
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		template = ""
+	}
+
+	c.mu.Lock()
+	c.templates[route] = template
+	c.mu.Unlock()
+	return template
+}
+
+// routeInfos returns the cached route list, calling walk to build it if
+// there is none. The caller gets its own copy.
+func (c *routeCache) routeInfos(walk func() []RouteInfo) []RouteInfo {
+	c.mu.RLock()
+	infos, ok := c.infos, c.infosOK
+	c.mu.RUnlock()
+
+	if !ok {
+		infos = walk()
+		c.mu.Lock()
+		c.infos, c.infosOK = infos, true
+		c.mu.Unlock()
+	}
+	return append([]RouteInfo(nil), infos...)
+}
+
+// reset discards the cached route list
+func (c *routeCache) reset() {
+	c.mu.Lock()
+	c.infos, c.infosOK = nil, false
+	c.mu.Unlock()
+}
+
+// routeTemplate returns the path template of the route matched for r, such
+// as "/api/v1/users/{id}", or "" if no route matched
+func (a *App) routeTemplate(r *http.Request) string {
+	return a.routes.template(mux.CurrentRoute(r))
+}
+
+// RouteGroup registers routes under a common path prefix. Routes in a group
+// pass through the app's middleware chain plus any added with Use.
+type RouteGroup struct {
+	app    *App
+	router *mux.Router
+}
+
+// Use adds middleware to every route. Middleware runs in the order it was
+// added, and always inside the recovery middleware that setupRoutes
+// installs first, so a panic in added middleware or in a handler is still
+// turned into a 500. Middleware added after routes are registered applies
+// to them as well.
+func (a *App) Use(mw ...mux.MiddlewareFunc) {
+	a.middleware = append(a.middleware, mw...)
+	a.Router.Use(mw...)
+}
+
+// Handler returns the app as an http.Handler, for serving it from a custom
+// http.Server or mounting it in a parent mux, for example under a path
+// prefix with http.StripPrefix. It is the handler that Start and the other
+// Start methods serve.
+//
+// The middleware added with Use is attached to Router, so it runs for
+// matched routes and for the not found and method not allowed responses.
+// Handler adds the recovery middleware around Router as well, so that a
+// panic outside that chain, such as in trailing slash handling, still gets
+// a 500 response. Servers other than the app's own should set ConnContext
+// to logger.ConnContext to get the conn_reused access log field.
+func (a *App) Handler() http.Handler {
+	return a.recoveryMiddleware(a.Router)
+}
+
+// Handle registers handler for method and path. OPTIONS is always accepted
+// as well so that CORS preflight requests reach the middleware chain.
+func (a *App) Handle(method, path string, handler http.HandlerFunc) *mux.Route {
+	a.routes.reset()
+	return handle(a.Router, method, path, handler)
+}
+
+// Group returns a RouteGroup for routes under prefix
+func (a *App) Group(prefix string) *RouteGroup {
+	return &RouteGroup{app: a, router: a.Subrouter(prefix)}
+}
+
+// Subrouter returns a mux router for routes under prefix, for code that
+// works with mux directly. It is part of the app's router, so the app's
+// middleware applies to its routes without being added again, and its
+// routes are included in metrics labels and in Routes. Middleware added
+// to the subrouter with Use runs inside the app's middleware.
+func (a *App) Subrouter(prefix string) *mux.Router {
+	a.routes.reset()
+	return a.Router.PathPrefix(prefix).Subrouter()
+}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Routes returns every registered route in registration order, with one
+// entry per method. The OPTIONS method that Handle adds for CORS preflight
+// requests is omitted, as are prefixes that only hold subrouters.
+//
+// The list is cached until a route is registered through the App or a
+// RouteGroup. Routes added straight to a router from Subrouter after Routes
+// has been called are listed once the next route is registered.
+func (a *App) Routes() []RouteInfo {
+	return a.routes.routeInfos(a.walkRoutes)
+}
+
+// walkRoutes builds the list returned by Routes
+func (a *App) walkRoutes() []RouteInfo {
+	var routes []RouteInfo
+	a.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			// The route accepts any method
+			methods = []string{"*"}
+		}
+		for _, method := range methods {
+			if method == http.MethodOptions && len(methods) > 1 {
+				continue
+			}
+			routes = append(routes, RouteInfo{Method: method, Path: path, Name: route.GetName()})
+		}
+		return nil
+	})
+	return routes
+}
+
+// Handle registers handler for method and path relative to the group prefix
+func (g *RouteGroup) Handle(method, path string, handler http.HandlerFunc) *mux.Route {
+	g.app.routes.reset()
+	return handle(g.router, method, path, handler)
+}
+
+// Group returns a nested RouteGroup for routes under prefix
+func (g *RouteGroup) Group(prefix string) *RouteGroup {
+	g.app.routes.reset()
+	return &RouteGroup{app: g.app, router: g.router.PathPrefix(prefix).Subrouter()}
+}
+
+// Use adds middleware that only applies to routes in the group. It runs
+// inside the app's middleware chain.
+func (g *RouteGroup) Use(mw ...mux.MiddlewareFunc) {
+	g.router.Use(mw...)
+}
+
+// SetFallbackHandler sets the handler for requests that match no route,
+// for example to proxy them to another service or to serve a single-page
+// app's index. Passing nil restores the default JSON 404 response. The
+// handler runs through the app's middleware. Paths with a trailing slash
+// are first handled according to TRAILING_SLASH.
+func (a *App) SetFallbackHandler(h http.Handler) {
+	if h == nil {
+		h = http.HandlerFunc(notFoundHandler)
+	}
+	a.Router.NotFoundHandler = a.slashRedirectMiddleware(a.Config.Server.TrailingSlash)(a.withMiddleware(h))
+}
+
+// withMiddleware runs h through the recovery middleware and the middleware
+// added with Use, for handlers that mux calls without its middleware chain
+// such as the not found and method not allowed handlers. The chain is
+// built per request so that middleware added later applies as well.
+func (a *App) withMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := h
+		for i := len(a.middleware) - 1; i >= 0; i-- {
+			handler = a.middleware[i](handler)
+		}
+		a.recoveryMiddleware(handler).ServeHTTP(w, r)
+	})
+}
+
+// notFoundHandler is the default fallback handler
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	render.Error(w, http.StatusNotFound, "not found")
+}
+
+// allowMethods are the methods reported in the Allow header of a 405
+var allowMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// methodNotAllowedHandler answers requests for a route that exists but
+// does not accept the method, listing the methods it does accept in the
+// Allow header
+func (a *App) methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, method := range allowMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		var match mux.RouteMatch
+		if a.Router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	render.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func handle(router *mux.Router, method, path string, handler http.HandlerFunc) *mux.Route {
+	methods := []string{method}
+	if method != http.MethodOptions {
+		methods = append(methods, http.MethodOptions)
+	}
+	return router.HandleFunc(path, handler).Methods(methods...)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestHandle(t *testing.T) {
+	app := NewApp()
+	app.Handle("POST", "/items", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		expectedStatus int
+	}{
+		{name: "Registered method", method: "POST", expectedStatus: http.StatusCreated},
+		{name: "Preflight", method: "OPTIONS", expectedStatus: http.StatusOK},
+		{name: "Other method", method: "GET", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/items", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus != http.StatusMethodNotAllowed {
+				assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	app := NewApp()
+
+	var order []string
+	trace := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	users := app.Group("/api/v2").Group("/users")
+	users.Use(trace("users"))
+	users.Handle("GET", "/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "user")
+	})
+
+	req, err := http.NewRequest("GET", "/api/v2/users/42", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "user", rr.Body.String())
+	assert.Equal(t, []string{"users"}, order)
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"), "app middleware should apply to groups")
+}
+
+func TestRouteTemplate(t *testing.T) {
+	app := NewApp()
+
+	var template string
+	app.Handle("GET", "/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		template = app.routeTemplate(r)
+	})
+
+	req, err := http.NewRequest("GET", "/users/42", nil)
+	require.NoError(t, err)
+	app.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "/users/{id}", template)
+	assert.Equal(t, "", app.routeTemplate(req), "requests outside the router have no route")
+}
+
+// BenchmarkRouteTemplate shows that looking up a matched route's template
+// costs the same no matter how many routes are registered
+func BenchmarkRouteTemplate(b *testing.B) {
+	for _, count := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("routes=%d", count), func(b *testing.B) {
+			app := NewApp()
+			for i := 0; i < count; i++ {
+				app.Handle("GET", fmt.Sprintf("/resource%d/{id}", i), func(w http.ResponseWriter, r *http.Request) {})
+			}
+
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/resource%d/42", count-1), nil)
+			var match mux.RouteMatch
+			if !app.Router.Match(req, &match) {
+				b.Fatal("route did not match")
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				app.routes.template(match.Route)
+			}
+		})
+	}
+}
+
+// BenchmarkServeHTTP serves a request for the last of many registered
+// routes through the app's router, with its complete middleware chain,
+// and through a bare mux router, so that the chain's per-request overhead
+// can be compared as the number of routes grows
+func BenchmarkServeHTTP(b *testing.B) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	for _, count := range []int{10, 100, 1000} {
+		cfg := config.Default()
+		cfg.Metrics.Enabled = true
+		app := NewAppWithConfig(cfg)
+		app.Logger.SetOutput(io.Discard)
+		bare := mux.NewRouter()
+		for i := 0; i < count; i++ {
+			path := fmt.Sprintf("/resource%d/{id}", i)
+			app.Handle("GET", path, noop)
+			handle(bare, "GET", path, noop)
+		}
+
+		routers := []struct {
+			name   string
+			router *mux.Router
+		}{
+			{name: "with middleware", router: app.Router},
+			{name: "without middleware", router: bare},
+		}
+		for _, r := range routers {
+			b.Run(fmt.Sprintf("routes=%d/%s", count, r.name), func(b *testing.B) {
+				req := httptest.NewRequest("GET", fmt.Sprintf("/resource%d/42", count-1), nil)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					r.router.ServeHTTP(httptest.NewRecorder(), req)
+				}
+			})
+		}
+	}
+}
+
+func TestFallbackHandler(t *testing.T) {
+	app := NewApp()
+
+	req, err := http.NewRequest("GET", "/missing", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error": "not found"}`, rr.Body.String())
+
+	app.SetFallbackHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "index for %s", r.URL.Path)
+	}))
+
+	rr = httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "index for /missing", rr.Body.String())
+
+	// Matched routes are unaffected
+	req, err = http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	assert.Contains(t, rr.Body.String(), "healthy")
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	app := NewApp()
+	app.Handle("DELETE", "/api/v1/status", func(w http.ResponseWriter, r *http.Request) {})
+
+	req, err := http.NewRequest("POST", "/api/v1/status", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error": "method not allowed"}`, rr.Body.String())
+	assert.Equal(t, "GET, DELETE, OPTIONS", rr.Header().Get("Allow"))
+}
+
+func TestErrorHandlersRunMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		expectedCode int
+	}{
+		{name: "Not found", method: "GET", path: "/missing", expectedCode: http.StatusNotFound},
+		{name: "Method not allowed", method: "POST", path: "/health", expectedCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp()
+			var buf bytes.Buffer
+			app.Logger.SetOutput(&buf)
+
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Origin", "https://app.example.com")
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"), "CORS middleware ran")
+			assert.Contains(t, buf.String(), `"message":"HTTP request"`, "logging middleware ran")
+			assert.Contains(t, buf.String(), fmt.Sprintf(`"status_code":%d`, tt.expectedCode))
+		})
+	}
+}
+
+func TestSubrouter(t *testing.T) {
+	app := NewApp()
+	var buf bytes.Buffer
+	app.Logger.SetOutput(&buf)
+
+	billing := app.Subrouter("/billing")
+	billing.HandleFunc("/invoices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, app.routeTemplate(r))
+	}).Methods("GET")
+
+	req, err := http.NewRequest("GET", "/billing/invoices/7", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "/billing/invoices/{id}", rr.Body.String())
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"), "app middleware should apply to subrouters")
+	assert.Equal(t, 1, strings.Count(buf.String(), `"message":"HTTP request"`), "app middleware should run once")
+}
+
+func TestRoutes(t *testing.T) {
+	app := NewApp()
+	app.Group("/api/v2").Handle("POST", "/items", func(w http.ResponseWriter, r *http.Request) {}).Name("create-item")
+	app.Subrouter("/billing").HandleFunc("/any", func(w http.ResponseWriter, r *http.Request) {})
+
+	routes := app.Routes()
+
+	assert.Contains(t, routes, RouteInfo{Method: "GET", Path: "/health"})
+	assert.Contains(t, routes, RouteInfo{Method: "GET", Path: "/api/v1/status"})
+	assert.Contains(t, routes, RouteInfo{Method: "POST", Path: "/api/v2/items", Name: "create-item"})
+	assert.Contains(t, routes, RouteInfo{Method: "*", Path: "/billing/any"})
+	for _, route := range routes {
+		assert.NotEqual(t, "OPTIONS", route.Method, "preflight methods are omitted")
+		assert.NotEqual(t, "/api/v1", route.Path, "subrouter prefixes are omitted")
+	}
+}
+
+func TestRoutesCachedUntilRegistration(t *testing.T) {
+	app := NewApp()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	before := app.Routes()
+	before[0].Path = "/changed"
+	assert.Equal(t, app.Routes(), app.Routes(), "repeated calls return the cached list")
+	assert.NotContains(t, app.Routes(), RouteInfo{Method: before[0].Method, Path: "/changed"}, "callers get their own copy")
+
+	app.Handle("GET", "/added", noop)
+	assert.Contains(t, app.Routes(), RouteInfo{Method: "GET", Path: "/added"})
+
+	app.Group("/grouped").Handle("PUT", "/item", noop)
+	assert.Contains(t, app.Routes(), RouteInfo{Method: "PUT", Path: "/grouped/item"})
+}
+
+func TestRoutesAdminEndpoint(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.AdminToken = "admin-token"
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Audit.SetOutput(io.Discard)
+
+	req, err := http.NewRequest("GET", "/admin/routes", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var routes []RouteInfo
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &routes))
+	assert.Contains(t, routes, RouteInfo{Method: "PUT", Path: "/admin/rate-limit"})
+	assert.Contains(t, routes, RouteInfo{Method: "GET", Path: "/admin/routes"})
+}
+
+func TestHandlerMountedUnderPrefix(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	parent := http.NewServeMux()
+	parent.Handle("/beto/", http.StripPrefix("/beto", app.Handler()))
+	server := httptest.NewServer(parent)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/beto/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("X-Request-ID"), "the middleware chain runs")
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+
+	// Unmatched paths get the app's 404 through the same chain
+	resp, err = http.Get(server.URL + "/beto/missing")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.JSONEq(t, `{"error": "not found"}`, string(body))
+	assert.NotEmpty(t, resp.Header.Get("X-Request-ID"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+// securityHeadersMiddleware sets the security headers configured in cfg on
+// every response. Strict-Transport-Security is only sent on requests that
+// arrived over TLS, as browsers ignore it on plain HTTP and it must not be
+// sent there.
+func (a *App) securityHeadersMiddleware(cfg config.SecurityConfig) mux.MiddlewareFunc {
+	var hsts string
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+	frameOptions := strings.ToUpper(cfg.FrameOptions)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			if cfg.ContentTypeNosniff {
+				header.Set("X-Content-Type-Options", "nosniff")
+			}
+			if frameOptions != "" {
+				header.Set("X-Frame-Options", frameOptions)
+			}
+			if cfg.ReferrerPolicy != "" {
+				header.Set("Referrer-Policy", cfg.ReferrerPolicy)
+			}
+			if hsts != "" && r.TLS != nil {
+				header.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
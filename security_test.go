@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name string
+		tls  bool
+		hsts string
+	}{
+		{name: "Plain HTTP", tls: false, hsts: ""},
+		{name: "TLS", tls: true, hsts: "max-age=31536000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/health", nil)
+			require.NoError(t, err)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, "DENY", rr.Header().Get("X-Frame-Options"))
+			assert.Equal(t, "strict-origin-when-cross-origin", rr.Header().Get("Referrer-Policy"))
+			assert.Equal(t, tt.hsts, rr.Header().Get("Strict-Transport-Security"))
+		})
+	}
+
+	// Unmatched routes get the headers as well
+	req, err := http.NewRequest("GET", "/missing", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+}
+
+func TestSecurityHeadersConfigured(t *testing.T) {
+	app := NewApp()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name     string
+		cfg      config.SecurityConfig
+		expected map[string]string
+	}{
+		{
+			name: "All disabled",
+			cfg:  config.SecurityConfig{},
+			expected: map[string]string{
+				"X-Content-Type-Options":    "",
+				"X-Frame-Options":           "",
+				"Referrer-Policy":           "",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name: "Custom values",
+			cfg: config.SecurityConfig{
+				FrameOptions:          "sameorigin",
+				ReferrerPolicy:        "no-referrer",
+				HSTSMaxAge:            time.Hour,
+				HSTSIncludeSubdomains: true,
+			},
+			expected: map[string]string{
+				"X-Content-Type-Options":    "",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Referrer-Policy":           "no-referrer",
+				"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.TLS = &tls.ConnectionState{}
+			rr := httptest.NewRecorder()
+			app.securityHeadersMiddleware(tt.cfg)(next).ServeHTTP(rr, req)
+
+			for header, value := range tt.expected {
+				assert.Equal(t, value, rr.Header().Get(header), header)
+			}
+		})
+	}
+}
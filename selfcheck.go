@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+	"github.com/darkcloud/beto/pkg/store"
+)
+
+// selfCheckTimeout bounds each connection attempt of the self-check
+const selfCheckTimeout = 10 * time.Second
+
+// selfCheck is one step of runSelfCheck
+type selfCheck struct {
+	name string
+	run  func(ctx context.Context, cfg *config.Config) error
+}
+
+// selfChecks are the steps of runSelfCheck, in order
+var selfChecks = []selfCheck{
+	{name: "config", run: func(_ context.Context, cfg *config.Config) error { return cfg.Validate() }},
+	{name: "database", run: checkDatabase},
+	{name: "redis", run: checkRedis},
+	{name: "upload path", run: checkUploadPath},
+}
+
+// runSelfCheck validates cfg and verifies that the database and Redis are
+// reachable and that uploads can be written, without starting the server.
+// Every check runs even if an earlier one fails so that a single run
+// reports every problem; the failures are returned joined together. It
+// backs the --check-config flag used as a pre-deploy gate.
+func runSelfCheck(cfg *config.Config) error {
+	var errs []error
+	for _, check := range selfChecks {
+		ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+		err := check.run(ctx, cfg)
+		cancel()
+
+		log := logger.WithField("check", check.name)
+		if err != nil {
+			log.WithField("error", err.Error()).Error("Self-check failed")
+			errs = append(errs, fmt.Errorf("%s: %w", check.name, err))
+			continue
+		}
+		log.Info("Self-check passed")
+	}
+	return errors.Join(errs...)
+}
+
+// checkDatabase opens and immediately closes a database connection
+func checkDatabase(ctx context.Context, cfg *config.Config) error {
+	db, err := store.OpenDatabase(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// checkRedis opens and immediately closes a Redis connection
+func checkRedis(ctx context.Context, cfg *config.Config) error {
+	client, err := store.OpenRedis(ctx, cfg.Redis)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+// checkUploadPath creates the upload directory if needed and writes and
+// removes a file in it
+func checkUploadPath(_ context.Context, cfg *config.Config) error {
+	path := cfg.FileUpload.UploadPath
+	if path == "" {
+		return errors.New("UPLOAD_PATH is empty")
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(path, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// captureGlobalLogger sends the global logger to a buffer for the test
+func captureGlobalLogger(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	original := logger.GetGlobalLogger()
+	logger.SetGlobalLogger(logger.New(logger.Config{Level: "info", Format: "json", Output: &buf}))
+	t.Cleanup(func() { logger.SetGlobalLogger(original) })
+	return &buf
+}
+
+// closedPort returns a local port with nothing listening on it
+func closedPort(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+	return port
+}
+
+func TestRunSelfCheckReportsEveryFailure(t *testing.T) {
+	buf := captureGlobalLogger(t)
+
+	cfg := config.Default()
+	cfg.FileUpload.UploadPath = t.TempDir()
+	cfg.Server.TrailingSlash = "sometimes"
+	cfg.Database.Host, cfg.Database.Port = "127.0.0.1", closedPort(t)
+	cfg.Redis.Host, cfg.Redis.Port = "127.0.0.1", closedPort(t)
+
+	err := runSelfCheck(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config: ")
+	assert.Contains(t, err.Error(), "TRAILING_SLASH")
+	assert.Contains(t, err.Error(), "database: connecting to postgres")
+	assert.Contains(t, err.Error(), "redis: connecting to redis")
+	assert.Contains(t, buf.String(), `"check":"redis"`)
+}
+
+func TestRunSelfCheckPasses(t *testing.T) {
+	buf := captureGlobalLogger(t)
+
+	// Stand in for the connection checks, which need running services
+	var ran []string
+	original := selfChecks
+	selfChecks = []selfCheck{original[0]}
+	for _, name := range []string{"database", "redis", "upload path"} {
+		name := name
+		selfChecks = append(selfChecks, selfCheck{name: name, run: func(context.Context, *config.Config) error {
+			ran = append(ran, name)
+			return nil
+		}})
+	}
+	t.Cleanup(func() { selfChecks = original })
+
+	cfg := config.Default()
+	cfg.FileUpload.UploadPath = t.TempDir()
+
+	require.NoError(t, runSelfCheck(cfg))
+	assert.Equal(t, []string{"database", "redis", "upload path"}, ran)
+	assert.Equal(t, 4, bytes.Count(buf.Bytes(), []byte("Self-check passed")))
+}
+
+func TestCheckUploadPath(t *testing.T) {
+	cfg := config.Default()
+	cfg.FileUpload.UploadPath = filepath.Join(t.TempDir(), "uploads")
+
+	require.NoError(t, checkUploadPath(context.Background(), cfg))
+	entries, err := os.ReadDir(cfg.FileUpload.UploadPath)
+	require.NoError(t, err, "the directory is created")
+	assert.Empty(t, entries, "the probe file is removed")
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	cfg.FileUpload.UploadPath = file
+	assert.Error(t, checkUploadPath(context.Background(), cfg))
+}
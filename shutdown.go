@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// OnShutdown registers fn to run during Shutdown after the server has
+// stopped accepting requests, for example to close a database pool or
+// flush logs. Hooks run in reverse registration order, so resources are
+// released in the opposite order to how they were set up. Each hook
+// receives the shutdown context and should return when it is done.
+func (a *App) OnShutdown(fn func(ctx context.Context) error) {
+	a.hooksMu.Lock()
+	defer a.hooksMu.Unlock()
+
+	a.shutdownHooks = append(a.shutdownHooks, fn)
+}
+
+// runShutdownHooks runs the registered hooks in LIFO order. A failing hook
+// is logged and does not stop the remaining hooks from running.
+func (a *App) runShutdownHooks(ctx context.Context) error {
+	a.hooksMu.Lock()
+	hooks := a.shutdownHooks
+	a.shutdownHooks = nil
+	a.hooksMu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			a.Logger.WithField("hook", i).Error("Shutdown hook failed: %v", err)
+			errs = append(errs, fmt.Errorf("shutdown hook %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
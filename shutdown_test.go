@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+type ctxKey string
+
+func TestShutdownHooksRunInReverseOrder(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	var order []string
+	var received []context.Context
+	hook := func(name string) func(context.Context) error {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			received = append(received, ctx)
+			return nil
+		}
+	}
+	app.OnShutdown(hook("db"))
+	app.OnShutdown(hook("logger"))
+	app.OnShutdown(hook("discovery"))
+
+	ctx := context.WithValue(context.Background(), ctxKey("shutdown"), "yes")
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Shutdown(ctx))
+
+	assert.Equal(t, []string{"discovery", "logger", "db"}, order)
+	for _, got := range received {
+		assert.Equal(t, "yes", got.Value(ctxKey("shutdown")))
+		_, hasDeadline := got.Deadline()
+		assert.True(t, hasDeadline)
+	}
+}
+
+func TestShutdownHookErrorsDoNotAbort(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	ran := false
+	failure := errors.New("deregistration failed")
+	app.OnShutdown(func(context.Context) error { ran = true; return nil })
+	app.OnShutdown(func(context.Context) error { return failure })
+
+	err := app.Shutdown(context.Background())
+	assert.ErrorIs(t, err, failure)
+	assert.True(t, ran, "hooks after a failing one must still run")
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func readyzStatus(t *testing.T, app *App) int {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestReadyz(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"ready"`)
+
+	require.NoError(t, app.Shutdown(context.Background()))
+
+	rr = httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"not ready"`)
+}
+
+func TestShutdownPreShutdownDelay(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.PreShutdownDelay = 200 * time.Millisecond
+	app := NewAppWithConfig(cfg)
+	out := &syncBuffer{}
+	app.Logger.SetOutput(out)
+	app.Server = &http.Server{Handler: app.Router}
+
+	drained := false
+	app.OnShutdown(func(context.Context) error { drained = true; return nil })
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- app.Shutdown(context.Background()) }()
+
+	require.Eventually(t, func() bool { return readyzStatus(t, app) == http.StatusServiceUnavailable }, time.Second, 5*time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the pre-shutdown delay")
+	default:
+	}
+
+	require.NoError(t, <-done)
+	assert.GreaterOrEqual(t, time.Since(start), cfg.Server.PreShutdownDelay)
+	assert.True(t, drained)
+
+	logs := out.String()
+	phases := []string{"Shutting down server", "Marked not ready", "Draining connections", "Running shutdown hooks"}
+	last := -1
+	for _, phase := range phases {
+		i := strings.Index(logs, phase)
+		require.NotEqual(t, -1, i, "%q is logged", phase)
+		assert.Greater(t, i, last, "%q is logged in order", phase)
+		last = i
+	}
+}
+
+func TestShutdownPreShutdownDelayCancelled(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.PreShutdownDelay = time.Hour
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Server = &http.Server{Handler: app.Router}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	app.Shutdown(ctx)
+	assert.Less(t, time.Since(start), time.Second, "the delay ends when ctx is done")
+}
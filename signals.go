@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+// handleSignals waits on signals, calling reload for each SIGHUP, and
+// returns the first other signal, which should shut the server down. It
+// returns nil if signals is closed.
+func handleSignals(signals <-chan os.Signal, reload func()) os.Signal {
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reload()
+			continue
+		}
+		return sig
+	}
+	return nil
+}
+
+// Reload applies the settings from cfg that are safe to change on a running
+// server: the log level, of both the app and the global logger, and the
+// rate limit. They are also copied into a.Config so that /admin/config
+// shows the live values. See config.Watch for the settings that need a
+// restart.
+func (a *App) Reload(cfg *config.Config) {
+	level := logger.ParseLevel(cfg.Logging.Level)
+	a.Logger.SetLevel(level)
+	logger.SetLevel(level)
+
+	limit := 0
+	if cfg.RateLimit.Enabled {
+		limit = cfg.RateLimit.RequestsPerWindow
+	}
+	a.SetRateLimit(limit, cfg.RateLimit.WindowDuration)
+
+	a.configMu.Lock()
+	a.Config.Logging.Level = cfg.Logging.Level
+	a.Config.RateLimit = cfg.RateLimit
+	a.configMu.Unlock()
+
+	a.Logger.WithField("log_level", cfg.Logging.Level).Info("Configuration reloaded")
+}
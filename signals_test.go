@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+	"github.com/darkcloud/beto/pkg/logger"
+)
+
+func TestHandleSignals(t *testing.T) {
+	tests := []struct {
+		name            string
+		signals         []os.Signal
+		expectedSignal  os.Signal
+		expectedReloads int
+	}{
+		{name: "Terminate", signals: []os.Signal{syscall.SIGTERM}, expectedSignal: syscall.SIGTERM},
+		{name: "Interrupt", signals: []os.Signal{syscall.SIGINT}, expectedSignal: syscall.SIGINT},
+		{name: "Reloads before terminate", signals: []os.Signal{syscall.SIGHUP, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGHUP}, expectedSignal: syscall.SIGTERM, expectedReloads: 2},
+		{name: "Closed channel", signals: []os.Signal{syscall.SIGHUP}, expectedSignal: nil, expectedReloads: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signals := make(chan os.Signal, len(tt.signals))
+			for _, sig := range tt.signals {
+				signals <- sig
+			}
+			close(signals)
+
+			reloads := 0
+			sig := handleSignals(signals, func() { reloads++ })
+
+			assert.Equal(t, tt.expectedSignal, sig)
+			assert.Equal(t, tt.expectedReloads, reloads)
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	original := logger.GetGlobalLogger()
+	logger.SetGlobalLogger(logger.New(logger.Config{Level: "info", Output: io.Discard}))
+	defer logger.SetGlobalLogger(original)
+
+	app := newRateLimitedApp(t, 100)
+	assert.False(t, app.Logger.IsLevelEnabled(logger.DEBUG))
+
+	cfg := config.Default()
+	cfg.Logging.Level = "debug"
+	cfg.RateLimit = config.RateLimitConfig{Enabled: true, RequestsPerWindow: 2, WindowDuration: time.Minute}
+	app.Reload(cfg)
+
+	assert.True(t, app.Logger.IsLevelEnabled(logger.DEBUG))
+	assert.True(t, logger.GetGlobalLogger().IsLevelEnabled(logger.DEBUG), "the global logger follows the reload")
+	assert.Equal(t, 2, countAllowed(t, app, 4))
+
+	req, err := http.NewRequest("GET", "/admin/config", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var shown config.Config
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &shown))
+	assert.Equal(t, "debug", shown.Logging.Level, "/admin/config shows the reloaded settings")
+	assert.Equal(t, 2, shown.RateLimit.RequestsPerWindow)
+
+	cfg.RateLimit.Enabled = false
+	app.Reload(cfg)
+	assert.Equal(t, 4, countAllowed(t, app, 4), "disabling the rate limit takes effect live")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/render"
+)
+
+// signatureHeader carries the hex encoded HMAC-SHA256 of the request body
+const signatureHeader = "X-Signature"
+
+// signatureMiddleware verifies that the request body was signed with the
+// shared secret, for use on webhook routes. The signature may carry a
+// "sha256=" prefix. The body is restored so handlers can still read it.
+// Bodies larger than the MAX_FILE_SIZE upload limit are rejected with 413
+// before the signature is checked, so unauthenticated clients cannot make
+// the server buffer more than that.
+//
+// It is not attached to any route by default. Apply it to a group holding
+// the webhook routes, with the secret shared with the sender:
+//
+//	hooks := app.Group("/webhooks")
+//	hooks.Use(app.signatureMiddleware(secret))
+//	hooks.Handle("POST", "/payments", paymentsWebhookHandler)
+func (a *App) signatureMiddleware(secret []byte) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			signature := strings.TrimPrefix(r.Header.Get(signatureHeader), "sha256=")
+			expected, err := hex.DecodeString(signature)
+			if signature == "" || err != nil {
+				a.auditAuth(r, signature, "missing or malformed signature")
+				writeSignatureError(w, "missing or malformed signature")
+				return
+			}
+
+			if limit, err := a.Config.FileUpload.MaxBytes(); err == nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			body, err := io.ReadAll(r.Body)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				a.auditAuth(r, signature, "body too large")
+				render.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			if err != nil {
+				a.auditAuth(r, signature, "unreadable body")
+				writeSignatureError(w, "could not read request body")
+				return
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(body)
+			if !hmac.Equal(mac.Sum(nil), expected) {
+				a.auditAuth(r, signature, "invalid signature")
+				writeSignatureError(w, "invalid signature")
+				return
+			}
+
+			a.auditAuth(r, signature, "")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeSignatureError(w http.ResponseWriter, msg string) {
+	render.Error(w, http.StatusUnauthorized, msg)
+}
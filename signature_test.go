@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	const secret = "webhook-secret"
+	const body = `{"event": "push"}`
+
+	app := NewApp()
+	var received string
+	handler := app.signatureMiddleware([]byte(secret))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		signature      string
+		expectedStatus int
+	}{
+		{
+			name:           "Valid signature",
+			signature:      sign(secret, body),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Valid prefixed signature",
+			signature:      "sha256=" + sign(secret, body),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid signature",
+			signature:      sign("wrong-secret", body),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Missing signature",
+			signature:      "",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			req, err := http.NewRequest("POST", "/webhook", strings.NewReader(body))
+			require.NoError(t, err)
+			if tt.signature != "" {
+				req.Header.Set(signatureHeader, tt.signature)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, body, received, "handler should see the original body")
+			} else {
+				assert.Empty(t, received)
+			}
+		})
+	}
+}
+
+func TestSignatureMiddlewareLimitsBody(t *testing.T) {
+	const secret = "webhook-secret"
+	body := strings.Repeat("x", 64)
+
+	cfg := config.Default()
+	cfg.FileUpload.MaxFileSize = "32B"
+	app := NewAppWithConfig(cfg)
+	app.Audit.SetOutput(io.Discard)
+
+	called := false
+	handler := app.signatureMiddleware([]byte(secret))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+	req.Header.Set(signatureHeader, sign(secret, body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.JSONEq(t, `{"error": "request body exceeds 32 bytes"}`, rr.Body.String())
+	assert.False(t, called)
+}
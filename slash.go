@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// slashRedirectMiddleware handles requests whose path has a trailing slash
+// that the matching route does not, according to mode, which is one of the
+// TRAILING_SLASH values. In "redirect" mode the client is sent to the path
+// without the slash, keeping the query string, with a 301 for GET and HEAD
+// and a 308 otherwise so that the method and body are preserved. In
+// "ignore" mode the route is served directly. Requests that would not
+// match a route without the slash are passed to next.
+//
+// mux only runs middleware for matched routes, so this wraps the router's
+// NotFoundHandler rather than being added with Use.
+func (a *App) slashRedirectMiddleware(mode string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if mode != "redirect" && mode != "ignore" {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := strings.TrimRight(r.URL.Path, "/")
+			if path == r.URL.Path || path == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			trimmed := r.Clone(r.Context())
+			trimmed.URL.Path = path
+			trimmed.URL.RawPath = ""
+
+			var match mux.RouteMatch
+			if !a.Router.Match(trimmed, &match) || match.MatchErr != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if mode == "ignore" {
+				a.Router.ServeHTTP(w, trimmed)
+				return
+			}
+
+			status := http.StatusPermanentRedirect
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				status = http.StatusMovedPermanently
+			}
+			location := trimmed.URL.EscapedPath()
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, location, status)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func newSlashApp(t *testing.T, mode string) *App {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Server.TrailingSlash = mode
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Handle("POST", "/api/v1/items", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+	return app
+}
+
+func TestTrailingSlash(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             string
+		method           string
+		path             string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{name: "Strict GET without slash", mode: "strict", method: "GET", path: "/api/v1/status", expectedCode: http.StatusOK},
+		{name: "Strict GET with slash", mode: "strict", method: "GET", path: "/api/v1/status/", expectedCode: http.StatusNotFound},
+		{name: "Strict POST with slash", mode: "strict", method: "POST", path: "/api/v1/items/", expectedCode: http.StatusNotFound},
+
+		{name: "Redirect GET without slash", mode: "redirect", method: "GET", path: "/api/v1/status", expectedCode: http.StatusOK},
+		{name: "Redirect GET with slash", mode: "redirect", method: "GET", path: "/api/v1/status/?verbose=1", expectedCode: http.StatusMovedPermanently, expectedLocation: "/api/v1/status?verbose=1"},
+		{name: "Redirect POST without slash", mode: "redirect", method: "POST", path: "/api/v1/items", expectedCode: http.StatusCreated},
+		{name: "Redirect POST with slash", mode: "redirect", method: "POST", path: "/api/v1/items/", expectedCode: http.StatusPermanentRedirect, expectedLocation: "/api/v1/items"},
+		{name: "Redirect unknown path", mode: "redirect", method: "GET", path: "/missing/", expectedCode: http.StatusNotFound},
+		{name: "Redirect wrong method", mode: "redirect", method: "POST", path: "/api/v1/status/", expectedCode: http.StatusNotFound},
+		{name: "Redirect root", mode: "redirect", method: "GET", path: "/", expectedCode: http.StatusOK},
+
+		{name: "Ignore GET with slash", mode: "ignore", method: "GET", path: "/api/v1/status/", expectedCode: http.StatusOK},
+		{name: "Ignore POST with slash", mode: "ignore", method: "POST", path: "/api/v1/items/", expectedCode: http.StatusCreated},
+		{name: "Ignore POST without slash", mode: "ignore", method: "POST", path: "/api/v1/items", expectedCode: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newSlashApp(t, tt.mode)
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(`{"name":"item"}`))
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			app.Router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			assert.Equal(t, tt.expectedLocation, rr.Header().Get("Location"))
+			if tt.expectedCode == http.StatusCreated {
+				assert.Equal(t, `{"name":"item"}`, rr.Body.String(), "the body reaches the handler")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/darkcloud/beto/pkg/sse"
+)
+
+// HandleStreaming registers a handler for a long-lived response, such as
+// Server-Sent Events, for method and path. WRITE_TIMEOUT would cut such a
+// response off, so the write deadline is cleared for these requests only,
+// through http.ResponseController; every other route keeps the global
+// timeout. HANDLER_TIMEOUT does not apply to streaming routes either, as it
+// buffers the response.
+//
+// Clearing the deadline requires the underlying connection to support
+// deadline control, which connections served by net/http do. Where it is
+// not supported, for example with httptest.ResponseRecorder, the handler
+// runs with the deadline unchanged. Handlers that want a bound of their own
+// can set one with http.NewResponseController(w).SetWriteDeadline.
+func (a *App) HandleStreaming(method, path string, h http.HandlerFunc) *mux.Route {
+	route := a.Handle(method, path, a.streamingHandler(h))
+	a.streaming.Store(route, true)
+	return route
+}
+
+// isStreaming reports whether r matched a route registered with
+// HandleStreaming
+func (a *App) isStreaming(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	_, ok := a.streaming.Load(route)
+	return ok
+}
+
+// streamingHandler clears the write deadline before calling h
+func (a *App) streamingHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			a.Logger.WithField("error", err.Error()).Warn("Could not clear write deadline for streaming response")
+		}
+		h(w, r)
+	}
+}
+
+// eventsInterval is how often eventsHandler sends a status event
+var eventsInterval = time.Second
+
+// eventsHandler streams a status event as Server-Sent Events every
+// eventsInterval until the client disconnects
+func (a *App) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	stream, err := sse.NewStream(w)
+	if err != nil {
+		a.Logger.WithField("error", err.Error()).Warn("Starting event stream failed")
+		return
+	}
+
+	ticker := time.NewTicker(eventsInterval)
+	defer ticker.Stop()
+
+	for {
+		err := stream.SendJSON("status", statusResponse{
+			API:    "v1",
+			Status: "running",
+			Uptime: time.Since(startTime).String(),
+		})
+		if err != nil {
+			// The client is gone
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
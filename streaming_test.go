@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+// startApp starts app on a random port and shuts it down at the end of
+// the test, returning its address
+func startApp(t *testing.T, app *App) string {
+	t.Helper()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- app.Start("0")
+	}()
+	addr := waitForAddr(t, app)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		app.Shutdown(ctx)
+		<-errCh
+	})
+	return addr
+}
+
+func TestHandleStreamingOutlivesWriteTimeout(t *testing.T) {
+	previous := eventsInterval
+	eventsInterval = 50 * time.Millisecond
+	defer func() { eventsInterval = previous }()
+
+	cfg := config.Default()
+	cfg.Server.WriteTimeout = 100 * time.Millisecond
+	cfg.Server.HandlerTimeout = 100 * time.Millisecond
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	addr := startApp(t, app)
+
+	resp, err := http.Get("http://" + addr + "/api/v1/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Read events for well past both timeouts
+	scanner := bufio.NewScanner(resp.Body)
+	deadline := time.Now().Add(400 * time.Millisecond)
+	events := 0
+	for time.Now().Before(deadline) && scanner.Scan() {
+		if scanner.Text() == "event: status" {
+			events++
+		}
+	}
+	require.NoError(t, scanner.Err())
+	assert.GreaterOrEqual(t, events, 6)
+}
+
+func TestWriteTimeoutStillAppliesToOtherRoutes(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.WriteTimeout = 100 * time.Millisecond
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	app.Handle("GET", "/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "too late")
+	})
+	addr := startApp(t, app)
+
+	resp, err := http.Get("http://" + addr + "/slow")
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	assert.Error(t, err, "the write deadline cuts the response off")
+}
+
+func TestIsStreaming(t *testing.T) {
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	var streaming, regular bool
+	app.HandleStreaming("GET", "/stream", func(w http.ResponseWriter, r *http.Request) {
+		streaming = app.isStreaming(r)
+	})
+	app.Handle("GET", "/regular", func(w http.ResponseWriter, r *http.Request) {
+		regular = app.isStreaming(r)
+	})
+
+	for _, path := range []string{"/stream", "/regular"} {
+		app.Router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	assert.True(t, streaming)
+	assert.False(t, regular)
+	assert.False(t, app.isStreaming(httptest.NewRequest("GET", "/stream", nil)), "requests outside the router are not streaming")
+}
+
+func TestEventsEndpoint(t *testing.T) {
+	previous := eventsInterval
+	eventsInterval = 10 * time.Millisecond
+	defer func() { eventsInterval = previous }()
+
+	cfg := config.Default()
+	cfg.Metrics.Enabled = true
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	var events []statusResponse
+	for len(events) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var status statusResponse
+			require.NoError(t, json.Unmarshal([]byte(data), &status))
+			events = append(events, status)
+			continue
+		}
+		if line != "" {
+			assert.Equal(t, "event: status", line)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, events, 2)
+	assert.Equal(t, "running", events[1].Status)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// timeoutBody is sent when a handler exceeds its deadline
+const timeoutBody = `{"error": "request timed out"}`
+
+// timeoutMiddleware cancels the request context after d and answers with a
+// 503 JSON response if the handler has not finished by then. The handler's
+// output is buffered until it completes. Middleware registered before this
+// one, such as CORS and logging, still applies to the timeout response.
+// WebSocket handshakes and streaming routes bypass the timeout, since a
+// buffered response cannot be hijacked or streamed and the connection is
+// meant to outlive the request.
+func (a *App) timeoutMiddleware(d time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		timeout := http.TimeoutHandler(next, d, timeoutBody)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWebSocketUpgrade(r) || a.isStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timeout.ServeHTTP(jsonTimeoutWriter{w}, r)
+		})
+	}
+}
+
+// jsonTimeoutWriter labels the timeout response written by
+// http.TimeoutHandler as JSON, which it would otherwise sniff as plain text
+type jsonTimeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (w jsonTimeoutWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
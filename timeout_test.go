@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.HandlerTimeout = 50 * time.Millisecond
+	app := NewAppWithConfig(cfg)
+	var logs bytes.Buffer
+	app.Logger.SetOutput(&logs)
+
+	app.Handle("GET", "/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+
+	req, err := http.NewRequest("GET", "/slow", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, timeoutBody, rr.Body.String())
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	fields := lastAccessLogFields(t, &logs)
+	assert.Equal(t, float64(http.StatusServiceUnavailable), fields["status_code"])
+	assert.Equal(t, "/slow", fields["url"])
+}
+
+func TestTimeoutMiddlewareFastHandler(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.HandlerTimeout = time.Second
+	app := NewAppWithConfig(cfg)
+
+	req, err := http.NewRequest("GET", "/health", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "healthy")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+)
+
+// defaultTLSConfig returns the TLS settings used when App.TLSConfig is nil.
+// TLS 1.2 is the minimum version and only forward-secret AEAD cipher suites
+// are offered; TLS 1.3 suites are not configurable and always enabled.
+func defaultTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+	}
+}
+
+// StartTLS initializes and starts the HTTPS server using the given
+// certificate and key files. App.TLSConfig, when set, replaces the default
+// TLS settings. Shutdown stops the server exactly as it does for Start.
+func (a *App) StartTLS(port, certFile, keyFile string) error {
+	a.Server = a.newServer(port)
+	a.Server.TLSConfig = a.TLSConfig
+	if a.Server.TLSConfig == nil {
+		a.Server.TLSConfig = defaultTLSConfig()
+	}
+
+	ln, err := a.listen()
+	if err != nil {
+		return err
+	}
+
+	a.logStartup(listenPort(ln, port), true)
+	return a.Server.ServeTLS(ln, certFile, keyFile)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate and key for
+// localhost and returns their paths
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestAppStartTLSAndShutdown(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	app := NewApp()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- app.StartTLS("0", certFile, keyFile)
+	}()
+
+	waitForAddr(t, app)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Shutdown(ctx))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+
+	assert.Equal(t, uint16(tls.VersionTLS12), app.Server.TLSConfig.MinVersion)
+	assert.NotEmpty(t, app.Server.TLSConfig.CipherSuites)
+}
+
+func TestAppStartTLSConfigOverride(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	app := NewApp()
+	app.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- app.StartTLS("0", certFile, keyFile)
+	}()
+
+	waitForAddr(t, app)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, app.Shutdown(ctx))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+
+	assert.Equal(t, uint16(tls.VersionTLS13), app.Server.TLSConfig.MinVersion)
+}
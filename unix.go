@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+)
+
+// unixSocketMode lets the owner and group, such as an nginx worker added
+// to the app's group, connect to the socket
+const unixSocketMode = 0o660
+
+// StartUnix initializes and starts the HTTP server on a Unix domain socket
+// at socketPath, for a reverse proxy on the same host such as nginx. A
+// stale socket left by a previous run is removed first; a socket that
+// still accepts connections, or a file that is not a socket, is an error.
+// The socket is made readable and writable by its owner and group only,
+// and Shutdown removes it.
+func (a *App) StartUnix(socketPath string) error {
+	if err := removeStaleSocket(socketPath); err != nil {
+		return err
+	}
+
+	a.Server = a.newServer("")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	// Closing the listener in Shutdown removes the socket file
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+
+	if err := os.Chmod(socketPath, unixSocketMode); err != nil {
+		ln.Close()
+		return fmt.Errorf("setting socket permissions: %w", err)
+	}
+	a.setListener(ln)
+
+	a.startupLogger(false).WithField("socket", socketPath).Info("Starting %s on unix socket %s", appName, socketPath)
+	return a.Server.Serve(ln)
+}
+
+// removeStaleSocket removes the socket at path unless a server is still
+// listening on it. A missing file is not an error.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another server", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unixClient returns an HTTP client that connects to the socket at path
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestAppStartUnix(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "beto.sock")
+
+	// A socket left behind by a process that did not shut down cleanly
+	stale, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	app := NewApp()
+	app.Logger.SetOutput(io.Discard)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- app.StartUnix(socketPath)
+	}()
+	assert.Equal(t, socketPath, waitForAddr(t, app))
+
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(unixSocketMode), info.Mode().Perm())
+
+	resp, err := unixClient(socketPath).Get("http://beto/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, app.Shutdown(ctx))
+	assert.Equal(t, http.ErrServerClosed, <-errCh)
+
+	_, err = os.Stat(socketPath)
+	assert.ErrorIs(t, err, fs.ErrNotExist, "shutdown removes the socket")
+}
+
+func TestAppStartUnixRefusesExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	regular := filepath.Join(dir, "data.txt")
+	require.NoError(t, os.WriteFile(regular, []byte("keep me"), 0o600))
+
+	live := filepath.Join(dir, "live.sock")
+	ln, err := net.Listen("unix", live)
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	for _, path := range []string{regular, live} {
+		app := NewApp()
+		app.Logger.SetOutput(io.Discard)
+		assert.Error(t, app.StartUnix(path))
+		_, err := os.Stat(path)
+		assert.NoError(t, err, "%s is left in place", path)
+	}
+}
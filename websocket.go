@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsReadLimit caps the size of a single message read from a WebSocket
+const wsReadLimit = 64 << 10
+
+// newUpgrader returns a WebSocket upgrader that applies the CORS origin
+// policy. Browsers do not send CORS preflights for WebSocket handshakes, so
+// the Access-Control headers set by corsMiddleware do not protect /ws; the
+// Origin header has to be checked during the upgrade instead.
+func (a *App) newUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: a.checkWebSocketOrigin,
+	}
+}
+
+// checkWebSocketOrigin allows the handshake when the Origin header is one of
+// CORS.AllowedOrigins. Clients that are not browsers usually send no Origin
+// and are allowed, as they are not subject to the same-origin policy.
+func (a *App) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	return a.Config.CORS.AllowsOrigin(origin)
+}
+
+// wsEchoHandler upgrades the connection and echoes every message back to
+// the client until it disconnects
+func (a *App) wsEchoHandler(upgrader *websocket.Upgrader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Upgrade writes the error response itself
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			a.Logger.WithField("error", err.Error()).Warn("WebSocket upgrade failed")
+			return
+		}
+		defer conn.Close()
+
+		conn.SetReadLimit(wsReadLimit)
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					a.Logger.WithField("error", err.Error()).Warn("WebSocket read failed")
+				}
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// isWebSocketUpgrade reports whether r is a WebSocket handshake
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkcloud/beto/pkg/config"
+)
+
+func newWebSocketServer(t *testing.T, origins []string) string {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Server.WebSocketEnabled = true
+	cfg.Server.HandlerTimeout = time.Second
+	cfg.Metrics.Enabled = true
+	cfg.RateLimit.ClientErrorThreshold = 10
+	cfg.CORS.AllowedOrigins = origins
+	app := NewAppWithConfig(cfg)
+	app.Logger.SetOutput(io.Discard)
+
+	server := httptest.NewServer(app.Router)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	url := newWebSocketServer(t, []string{"https://app.example.com"})
+
+	header := http.Header{"Origin": {"https://app.example.com"}}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	for _, msg := range []string{"hello", "world"} {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+
+		messageType, echoed, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, websocket.TextMessage, messageType)
+		assert.Equal(t, msg, string(echoed))
+	}
+}
+
+func TestWebSocketOriginCheck(t *testing.T) {
+	url := newWebSocketServer(t, []string{"https://app.example.com"})
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{name: "Allowed origin", origin: "https://app.example.com", allowed: true},
+		{name: "Other origin", origin: "https://evil.example.com", allowed: false},
+		{name: "No origin", origin: "", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if tt.allowed {
+				require.NoError(t, err)
+				conn.Close()
+				return
+			}
+			require.ErrorIs(t, err, websocket.ErrBadHandshake)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		})
+	}
+}
+
+func TestWebSocketDisabledByDefault(t *testing.T) {
+	app := NewApp()
+	req, err := http.NewRequest("GET", "/ws", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}